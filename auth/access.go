@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// AccessConfig describes users allowed to log in. Entries are either exact
+// emails ("user@example.com") or domains ("example.com") matching emails of
+// the domain and its subdomains.
+type AccessConfig struct {
+	// Allow lists users allowed to log in, any user not denied is allowed
+	// if the list is empty.
+	Allow []string
+	// Deny lists users denied to log in even if they're allowed.
+	Deny []string
+	// AllowFile and DenyFile are paths to files with additional entries, one
+	// per line. Files are reloaded on change.
+	AllowFile string
+	DenyFile  string
+}
+
+var errAccessDenied = errors.New("access denied")
+
+type accessList struct {
+	allow *emailList
+	deny  *emailList
+}
+
+// emailList is a list of email and domain entries, partially loaded from the
+// file. File is reloaded when its modification time changes.
+type emailList struct {
+	log     *zap.Logger
+	static  []string
+	file    string
+	m       sync.Mutex
+	modTime time.Time
+	size    int64
+	loaded  []string
+}
+
+func newAccessList(log *zap.Logger, config AccessConfig) (*accessList, error) {
+	allow, err := newEmailList(log, config.Allow, config.AllowFile)
+	if err != nil {
+		return nil, fmt.Errorf("allow list: %w", err)
+	}
+	deny, err := newEmailList(log, config.Deny, config.DenyFile)
+	if err != nil {
+		return nil, fmt.Errorf("deny list: %w", err)
+	}
+	return &accessList{allow: allow, deny: deny}, nil
+}
+
+// check returns errAccessDenied if the email is denied or isn't allowed.
+func (a *accessList) check(email string) error {
+	if a.deny.matches(email) {
+		return errAccessDenied
+	}
+	if allow := a.allow.entries(); len(allow) != 0 && !matchEmail(allow, email) {
+		return errAccessDenied
+	}
+	return nil
+}
+
+func newEmailList(log *zap.Logger, static []string, file string) (*emailList, error) {
+	l := &emailList{log: log, file: file}
+	for _, entry := range static {
+		if entry = normalizeEntry(entry); entry != "" {
+			l.static = append(l.static, entry)
+		}
+	}
+	if file != "" {
+		if err := l.reload(); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (l *emailList) matches(email string) bool {
+	return matchEmail(l.entries(), email)
+}
+
+// entries returns actual list entries, previous file entries are used if the
+// file can't be reloaded.
+func (l *emailList) entries() []string {
+	if l.file == "" {
+		return l.static
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+	if err := l.reload(); err != nil {
+		l.log.Error("failed to reload access list", zap.String("file", l.file), zap.Error(err))
+	}
+	return l.loaded
+}
+
+// reload reads the file if it was modified, must be called under lock.
+func (l *emailList) reload() error {
+	info, err := os.Stat(l.file)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(l.modTime) && info.Size() == l.size && l.loaded != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(l.file)
+	if err != nil {
+		return err
+	}
+
+	loaded := append(make([]string, 0, len(l.static)), l.static...)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if entry := normalizeEntry(line); entry != "" {
+			loaded = append(loaded, entry)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+
+	l.loaded, l.modTime, l.size = loaded, info.ModTime(), info.Size()
+	return nil
+}
+
+// normalizeEntry lowercases the entry and trims leading "@" and "." of
+// domain entries.
+func normalizeEntry(entry string) string {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	if strings.LastIndexByte(entry, '@') > 0 {
+		return entry
+	}
+	return strings.TrimLeft(entry, "@.")
+}
+
+func matchEmail(entries []string, email string) bool {
+	email = strings.ToLower(email)
+	domain := emailDomain(email)
+	for _, entry := range entries {
+		if strings.Contains(entry, "@") {
+			if entry == email {
+				return true
+			}
+		} else if matchDomain(entry, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// emailDomain returns domain part of the email.
+func emailDomain(email string) string {
+	return email[strings.LastIndexByte(email, '@')+1:]
+}
+
+// matchDomain checks that the lowercase domain is the normalized entry or its
+// subdomain.
+func matchDomain(entry, domain string) bool {
+	return domain == entry || strings.HasSuffix(domain, "."+entry)
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestNormalizeEntry(t *testing.T) {
+	for entry, expected := range map[string]string{
+		"User@Example.com":   "user@example.com",
+		" example.com ":      "example.com",
+		"@example.com":       "example.com",
+		".Example.com":       "example.com",
+		"@.example.com":      "example.com",
+		"first@last@example": "first@last@example",
+		"":                   "",
+		"@":                  "",
+	} {
+		if res := normalizeEntry(entry); res != expected {
+			t.Errorf("%q: expected %q, got %q", entry, expected, res)
+		}
+	}
+}
+
+func TestMatchEmail(t *testing.T) {
+	entries := []string{"example.com", "admin@other.com"}
+
+	for _, tc := range []struct {
+		email   string
+		matches bool
+	}{
+		{email: "user@example.com", matches: true},
+		{email: "User@EXAMPLE.com", matches: true},
+		{email: "user@dev.example.com", matches: true},
+		{email: "user@a.b.example.com", matches: true},
+		{email: "admin@other.com", matches: true},
+		{email: "ADMIN@other.com", matches: true},
+		{email: "user@evilexample.com"},
+		{email: "user@example.com.evil.com"},
+		{email: "user@example.co"},
+		{email: "example.com@evil.com"},
+		{email: "user@other.com"},
+		{email: "admin@sub.other.com"},
+		{email: "admin@other.com.evil.com"},
+		{email: "user@"},
+		{email: ""},
+	} {
+		t.Run(tc.email, func(t *testing.T) {
+			if res := matchEmail(entries, tc.email); res != tc.matches {
+				t.Fatalf("expected %t, got %t", tc.matches, res)
+			}
+		})
+	}
+}
+
+func TestAccessListCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		config  AccessConfig
+		allowed []string
+		denied  []string
+	}{
+		{
+			name:    "empty",
+			allowed: []string{"user@example.com", "user@evilexample.com"},
+		},
+		{
+			name:    "allow domain",
+			config:  AccessConfig{Allow: []string{"@Example.com"}},
+			allowed: []string{"user@example.com", "user@dev.example.com"},
+			denied:  []string{"user@evilexample.com", "user@example.com.evil.com"},
+		},
+		{
+			name:    "deny overrides allowed domain",
+			config:  AccessConfig{Allow: []string{"example.com"}, Deny: []string{"intern@example.com", "guests.example.com"}},
+			allowed: []string{"user@example.com"},
+			denied:  []string{"intern@example.com", "Intern@Example.com", "user@guests.example.com", "user@other.com"},
+		},
+		{
+			name:   "deny overrides allowed email",
+			config: AccessConfig{Allow: []string{"user@example.com"}, Deny: []string{"example.com"}},
+			denied: []string{"user@example.com"},
+		},
+		{
+			name:    "deny only",
+			config:  AccessConfig{Deny: []string{"evil.com"}},
+			allowed: []string{"user@example.com", "user@notevil.com"},
+			denied:  []string{"user@evil.com", "user@sub.evil.com"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := newAccessList(zap.NewNop(), tc.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, email := range tc.allowed {
+				if err = l.check(email); err != nil {
+					t.Errorf("%s must be allowed: %v", email, err)
+				}
+			}
+			for _, email := range tc.denied {
+				if err = l.check(email); !errors.Is(err, errAccessDenied) {
+					t.Errorf("%s must be denied, got %v", email, err)
+				}
+			}
+		})
+	}
+}
+
+func TestAccessListFile(t *testing.T) {
+	dir := t.TempDir()
+	allowFile, denyFile := filepath.Join(dir, "allow"), filepath.Join(dir, "deny")
+	write := func(path, data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(l *accessList, email string, allowed bool) {
+		t.Helper()
+		if err := l.check(email); (err == nil) != allowed {
+			t.Fatalf("%s: expected allowed %t, got %v", email, allowed, err)
+		}
+	}
+
+	if _, err := newAccessList(zap.NewNop(), AccessConfig{AllowFile: allowFile}); err == nil {
+		t.Fatal("missing file must be rejected on start")
+	}
+
+	write(allowFile, "# Allowed users.\nexample.com\n\nfriend@other.com # Comment.\n")
+	write(denyFile, "")
+	l, err := newAccessList(zap.NewNop(), AccessConfig{
+		Allow:     []string{"static@other.com"},
+		AllowFile: allowFile,
+		DenyFile:  denyFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(l, "user@example.com", true)
+	check(l, "friend@other.com", true)
+	check(l, "static@other.com", true)
+	check(l, "user@other.com", false)
+
+	// Files are reloaded on change, static entries are kept.
+	write(allowFile, "other.com\n")
+	write(denyFile, "intruder@other.com\n")
+	check(l, "user@example.com", false)
+	check(l, "user@other.com", true)
+	check(l, "intruder@other.com", false)
+	check(l, "static@other.com", true)
+
+	// Previous entries are used if the file can't be read.
+	if err = os.Remove(allowFile); err != nil {
+		t.Fatal(err)
+	}
+	check(l, "user@other.com", true)
+	check(l, "user@example.com", false)
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Error codes of JSON API responses.
+const (
+	errCodeInvalidRequest       = "invalid_request"
+	errCodeInvalidState         = "invalid_state"
+	errCodeInvalidGrant         = "invalid_grant"
+	errCodeUnsupportedGrantType = "unsupported_grant_type"
+	errCodeLoginFailed          = "login_failed"
+	errCodeUnverifiedEmail      = "unverified_email"
+	errCodeMissingAttribute     = "missing_attribute"
+	errCodeAccessDenied         = "access_denied"
+	errCodeServerError          = "server_error"
+)
+
+// loginError is a login failure to be reported to the client.
+type loginError struct {
+	status  int
+	code    string
+	message string
+	err     error
+}
+
+func newLoginError(status int, code, message string, err error) *loginError {
+	return &loginError{status: status, code: code, message: message, err: err}
+}
+
+// errorResponse is a JSON API error.
+type errorResponse struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// tokenResponse is a JSON API response with issued token.
+type tokenResponse struct {
+	// Bearer is a base64 encoded token, either bearer or session one.
+	Bearer       string            `json:"bearer"`
+	TokenType    string            `json:"token_type"`
+	EmailHash    string            `json:"email_hash,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	ContainerID  string            `json:"container_id"`
+	ExpiresEpoch uint64            `json:"expires_epoch"`
+	ExpiresAt    time.Time         `json:"expires_at"`
+	Owner        string            `json:"owner,omitempty"`
+	// RefreshToken can be passed to /refresh endpoint to get new token.
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+func newTokenResponse(token *issuedToken) *tokenResponse {
+	res := &tokenResponse{
+		Bearer:       token.Value,
+		TokenType:    token.kind,
+		EmailHash:    token.Identity,
+		Attributes:   token.Attributes,
+		ContainerID:  token.ContainerID.EncodeToString(),
+		ExpiresEpoch: token.Expiration,
+		ExpiresAt:    token.ExpiresAt.UTC().Truncate(time.Second),
+		RefreshToken: token.refreshToken,
+	}
+	if !token.Owner.IsZero() {
+		res.Owner = token.Owner.EncodeToString()
+	}
+	return res
+}
+
+// APIToken is a JSON counterpart of Callback for clients receiving callbacks
+// from external services themselves and passing state and code further.
+func (u *Authenticator) APIToken(w http.ResponseWriter, r *http.Request) {
+	if !u.requirePost(w, r) {
+		return
+	}
+
+	_, token, lErr := u.completeLogin(w, r)
+	if lErr != nil {
+		u.writeError(w, lErr)
+		return
+	}
+	u.writeJSON(w, http.StatusOK, newTokenResponse(token))
+}
+
+// wantsJSON checks whether the client prefers JSON response.
+func wantsJSON(r *http.Request) bool {
+	for accept := range strings.SplitSeq(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json":
+			return true
+		case "text/html", "*/*":
+			return false
+		}
+	}
+	return false
+}
+
+// requirePost responds with an error to requests other than POST.
+func (u *Authenticator) requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodPost {
+		return true
+	}
+	w.Header().Set("Allow", http.MethodPost)
+	u.writeJSON(w, http.StatusMethodNotAllowed, &errorResponse{
+		Error:       errCodeInvalidRequest,
+		Description: "method not allowed",
+	})
+	return false
+}
+
+func (u *Authenticator) writeError(w http.ResponseWriter, lErr *loginError) {
+	u.writeJSON(w, lErr.status, &errorResponse{Error: lErr.code, Description: lErr.message})
+}
+
+func (u *Authenticator) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		u.log.Error("couldn't write json response", zap.Error(err))
+	}
+}
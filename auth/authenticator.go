@@ -5,25 +5,46 @@ import (
 	"crypto/rand"
 	_ "embed"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/nspcc-dev/neofs-oauthz/bearer"
 	"github.com/nspcc-dev/neofs-sdk-go/client"
-	"github.com/nspcc-dev/neofs-sdk-go/pool"
+	cid "github.com/nspcc-dev/neofs-sdk-go/container/id"
+	"github.com/nspcc-dev/neofs-sdk-go/netmap"
 	"go.uber.org/zap"
+	"golang.org/x/oauth2"
 )
 
-//go:embed static/index.html
-var indexHTML string
+var (
+	//go:embed static/index.html
+	indexHTML string
+	//go:embed static/forbidden.html
+	forbiddenHTML string
+)
+
+// NetworkInfoGetter gets NeoFS network parameters, it's implemented by
+// pool.Pool.
+type NetworkInfoGetter interface {
+	NetworkInfo(ctx context.Context, prm client.PrmNetworkInfo) (netmap.NetworkInfo, error)
+}
 
 // Authenticator is an auth requests handler.
 type Authenticator struct {
 	log       *zap.Logger
-	sdkPool   *pool.Pool
-	generator *bearer.Generator
+	sdkPool   NetworkInfoGetter
+	issuer    *issuer
+	policies  []policy
 	config    *Config
 	services  *Services
+	redirects *redirectAllowList
+	access    *accessList
+	devices   *deviceStore
+	loopback  *loopbackStore
+	refresher *refresher
 }
 
 // Config for authenticator handler.
@@ -34,16 +55,75 @@ type Config struct {
 	TLSEnabled       bool
 	Host             string
 	RedirectURL      string
+	// AllowedRedirects are origins and path prefixes clients can request
+	// to be redirected to after login.
+	AllowedRedirects []string
+	StateStorage     StateStorage
+	StateTTL         time.Duration
+	// Policies override bearer config for matching users, the first
+	// matching policy is used.
+	Policies []Policy
+	// Access limits users allowed to log in.
+	Access AccessConfig
+	// Containers are named containers users can request tokens for.
+	Containers map[string]cid.ID
+	// UserBinding is a mode of binding tokens to user keys,
+	// UserBindingDisabled if empty.
+	UserBinding string
+	// TokenKinds are kinds of tokens users can request, the first one is
+	// issued by default. Only bearer tokens are issued if empty.
+	TokenKinds []string
+	// Cookie contains attributes of token and attribute cookies.
+	Cookie CookieConfig
+	// Device contains parameters of device authorization flow.
+	Device DeviceConfig
+	// Loopback contains parameters of loopback redirect login.
+	Loopback LoopbackConfig
+	// Refresh contains parameters of token refresh.
+	Refresh RefreshConfig
 }
 
 // New creates authenticator using config.
-func New(log *zap.Logger, sdkPool *pool.Pool, config *Config) (*Authenticator, error) {
+func New(log *zap.Logger, sdkPool NetworkInfoGetter, config *Config) (*Authenticator, error) {
+	redirects, err := newRedirectAllowList(config.RedirectURL, config.AllowedRedirects)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkUserBinding(config.UserBinding); err != nil {
+		return nil, err
+	}
+	if err = config.Cookie.validate(); err != nil {
+		return nil, err
+	}
+	issuer, err := newIssuer(config.Bearer, config.TokenKinds)
+	if err != nil {
+		return nil, err
+	}
+	policies, err := newPolicies(config.Policies, config.Containers, config.TokenKinds)
+	if err != nil {
+		return nil, err
+	}
+	access, err := newAccessList(log, config.Access)
+	if err != nil {
+		return nil, err
+	}
+	refresher, err := newRefresher(config.Refresh)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Authenticator{
 		log:       log,
 		sdkPool:   sdkPool,
 		config:    config,
-		generator: bearer.NewGenerator(config.Bearer),
-		services:  NewServices(config.Oauth),
+		issuer:    issuer,
+		policies:  policies,
+		services:  NewServices(config.Oauth, config.StateStorage),
+		redirects: redirects,
+		access:    access,
+		devices:   newDeviceStore(config.Device),
+		loopback:  newLoopbackStore(config.Loopback),
+		refresher: refresher,
 	}, nil
 }
 
@@ -76,75 +156,282 @@ func (u *Authenticator) LogInWith(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	b := make([]byte, 8)
-	_, _ = rand.Read(b)
+	login := config.NewLogin()
+	if returnTo := r.URL.Query().Get("return_to"); returnTo != "" {
+		returnURL, err := u.redirects.check(returnTo)
+		if err != nil {
+			u.log.Error("invalid return url", zap.String("return_to", returnTo), zap.Error(err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		login.ReturnTo = returnURL
+	}
+	if userCode := r.URL.Query().Get("user_code"); userCode != "" {
+		request, err := u.devices.request(userCode)
+		if err != nil {
+			u.log.Error("invalid user code", zap.String("user_code", userCode), zap.Error(err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		login.Container = request.Container
+		login.Owner = request.Owner
+		login.PublicKey = request.PublicKey
+		login.TokenKind = request.TokenKind
+		login.UserCode = normalizeUserCode(userCode)
+		login.ReturnTo = ""
+	} else if err := u.setTokenRequest(login, r.URL.Query()); err != nil {
+		u.log.Error("invalid token request", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Has("redirect_uri") {
+		if login.UserCode != "" || login.ReturnTo != "" {
+			msg := "redirect_uri can't be used with user_code or return_to"
+			u.log.Error(msg)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		if err := setLoopback(login, r.URL.Query()); err != nil {
+			u.log.Error("invalid loopback request", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	state, err := u.services.AddState(login)
+	if err != nil {
+		u.log.Error("couldn't save oauth state", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	u.setStateCookie(w, state, config.formPost)
 
-	state := hex.EncodeToString(b)
-	u.services.AddState(state, serviceName)
-	url := config.AuthCodeURL(state)
+	url := config.AuthCodeURL(state, login)
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
+// setTokenRequest saves parameters of the requested token.
+func (u *Authenticator) setTokenRequest(login *LoginState, query url.Values) error {
+	if container := query.Get("container"); container != "" {
+		if _, ok := u.config.Containers[container]; !ok {
+			return fmt.Errorf("unknown container '%s'", container)
+		}
+		login.Container = container
+	}
+	switch kind := query.Get("token"); kind {
+	case "", TokenBearer, TokenSession:
+		login.TokenKind = kind
+	default:
+		return fmt.Errorf("unsupported token kind '%s'", kind)
+	}
+	if err := u.setUserKey(login, query); err != nil {
+		return err
+	}
+	if login.TokenKind == TokenSession && login.PublicKey == "" {
+		return errors.New("session token requires public_key parameter")
+	}
+	return nil
+}
+
 // Callback is an external services callback handler.
 func (u *Authenticator) Callback(w http.ResponseWriter, r *http.Request) {
-	email, err := u.getUserInfo(r.Context(), r.FormValue("state"), r.FormValue("code"))
-	if err != nil {
-		fmt.Println(err.Error())
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+	login, token, lErr := u.completeLogin(w, r)
+	if login != nil && login.UserCode != "" {
+		u.completeDevice(w, login, token, lErr)
+		return
+	}
+	if login != nil && login.RedirectURI != "" {
+		u.completeLoopback(w, r, login, token, lErr)
+		return
+	}
+	if lErr != nil {
+		if wantsJSON(r) {
+			u.writeError(w, lErr)
+			return
+		}
+		switch lErr.code {
+		case errCodeAccessDenied:
+			u.forbidden(w)
+		case errCodeLoginFailed:
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		default:
+			http.Error(w, lErr.message, lErr.status)
+		}
 		return
 	}
 
-	strToken, hashedEmail, err := u.getBearerToken(r.Context(), email)
-	if err != nil {
-		u.log.Error("getting bearer token failed", zap.Error(err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if wantsJSON(r) {
+		u.writeJSON(w, http.StatusOK, newTokenResponse(token))
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:   u.config.BearerCookieName,
-		Value:  strToken,
-		MaxAge: 600,
-	})
+	u.setTokenCookies(w, token)
 
-	http.SetCookie(w, &http.Cookie{
-		Name:   "X-Attribute-Email",
-		Value:  hashedEmail,
-		MaxAge: 600,
-	})
+	redirectURL := u.config.RedirectURL
+	if login.ReturnTo != "" {
+		redirectURL = login.ReturnTo
+	}
+	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
+}
+
+// completeLogin checks callback request and issues token for the user.
+func (u *Authenticator) completeLogin(w http.ResponseWriter, r *http.Request) (*LoginState, *issuedToken, *loginError) {
+	state := r.FormValue("state")
+	if !u.checkStateCookie(w, r, state) {
+		msg := "login was started in another browser session, please log in again"
+		u.log.Error(msg)
+		return nil, nil, newLoginError(http.StatusBadRequest, errCodeInvalidState, msg, nil)
+	}
 
-	http.Redirect(w, r, u.config.RedirectURL, http.StatusTemporaryRedirect)
+	login, user, oauthToken, err := u.getUserInfo(r.Context(), state, r.FormValue("code"))
+	if err != nil {
+		u.log.Error("getting user info failed", zap.Error(err))
+		switch {
+		case errors.Is(err, errInvalidState):
+			return login, nil, newLoginError(http.StatusBadRequest, errCodeInvalidState,
+				"login session is invalid or expired, please log in again", err)
+		case errors.Is(err, errUnverifiedEmail):
+			return login, nil, newLoginError(http.StatusForbidden, errCodeUnverifiedEmail,
+				"login failed: the account has no verified email address", err)
+		default:
+			return login, nil, newLoginError(http.StatusUnauthorized, errCodeLoginFailed, "login failed", err)
+		}
+	}
+
+	token, lErr := u.issueToken(r.Context(), login, user)
+	if lErr != nil {
+		return login, nil, lErr
+	}
+	if u.refresher != nil {
+		if session := u.refresher.newSession(login, user, oauthToken); session != nil {
+			if err = u.setRefreshToken(token, session); err != nil {
+				return login, nil, newLoginError(http.StatusInternalServerError, errCodeServerError, err.Error(), err)
+			}
+		} else {
+			u.log.Debug("no refresh token from external service", zap.String("service", login.Service))
+		}
+	}
+	return login, token, nil
 }
 
-func (u *Authenticator) getUserInfo(ctx context.Context, state, code string) (string, error) {
-	service, err := u.services.RemoveState(state)
+// issueToken checks whether the user is allowed to get requested token and
+// issues it.
+func (u *Authenticator) issueToken(ctx context.Context, login *LoginState, user *Identity) (*issuedToken, *loginError) {
+	if err := u.access.check(user.Email); err != nil {
+		u.log.Info("login denied", zap.String("service", login.Service), zap.String("email", user.Email))
+		return nil, newLoginError(http.StatusForbidden, errCodeAccessDenied, "access denied", err)
+	}
+	issuer, containerID, err := u.tokenParams(user, login.Container)
+	if err != nil {
+		u.log.Info("container denied", zap.String("email", user.Email), zap.String("container", login.Container))
+		return nil, newLoginError(http.StatusForbidden, errCodeAccessDenied, "access to the container denied", err)
+	}
+	kind, err := issuer.kind(login.TokenKind)
 	if err != nil {
-		return "", err
+		u.log.Info("token kind denied", zap.String("email", user.Email), zap.String("token", login.TokenKind))
+		return nil, newLoginError(http.StatusForbidden, errCodeAccessDenied, err.Error(), err)
+	}
+
+	params := bearer.Params{
+		Email:       user.Email,
+		Subject:     user.Subject,
+		Provider:    user.Provider,
+		Name:        user.Name,
+		ContainerID: containerID,
+	}
+	if login.Owner != "" {
+		if err = params.UserID.DecodeString(login.Owner); err != nil {
+			u.log.Error("invalid token owner", zap.Error(err))
+			return nil, newLoginError(http.StatusBadRequest, errCodeInvalidRequest, err.Error(), err)
+		}
+	}
+	if params.PublicKey, err = userKey(login); err != nil {
+		u.log.Error("invalid user key", zap.Error(err))
+		return nil, newLoginError(http.StatusBadRequest, errCodeInvalidRequest, err.Error(), err)
+	}
+	if kind == TokenSession && params.PublicKey == nil {
+		msg := "session token requires public_key parameter"
+		u.log.Error(msg)
+		return nil, newLoginError(http.StatusBadRequest, errCodeInvalidRequest, msg, nil)
 	}
-	oauth, ok := u.services.Oauth(service)
+
+	token, err := u.getToken(ctx, issuer, kind, params)
+	if err != nil {
+		u.log.Error("getting token failed", zap.Error(err))
+		if errors.Is(err, bearer.ErrMissingAttribute) {
+			return nil, newLoginError(http.StatusForbidden, errCodeMissingAttribute, "login failed: "+err.Error(), err)
+		}
+		return nil, newLoginError(http.StatusInternalServerError, errCodeServerError, err.Error(), err)
+	}
+	return token, nil
+}
+
+func (u *Authenticator) getUserInfo(ctx context.Context, state, code string) (*LoginState, *Identity, *oauth2.Token, error) {
+	login, err := u.services.RemoveState(state)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	oauth, ok := u.services.Oauth(login.Service)
 	if !ok {
-		return "", fmt.Errorf("invalid oauth service")
+		return login, nil, nil, fmt.Errorf("invalid oauth service")
 	}
 
-	token, err := oauth.Exchange(ctx, code)
+	token, err := oauth.Exchange(ctx, code, login)
 	if err != nil {
-		return "", fmt.Errorf("code exchange failed: %s", err.Error())
+		return login, nil, nil, fmt.Errorf("code exchange failed: %s", err.Error())
 	}
 
-	email, err := oauth.GetUserEmail(ctx, token)
+	user, err := oauth.GetUser(ctx, token, login)
 	if err != nil {
-		return "", err
+		return login, nil, nil, err
 	}
+	user.Provider = login.Service
+
+	return login, user, token, nil
+}
 
-	return email, nil
+// issuedToken is a token along with its approximate expiration time.
+type issuedToken struct {
+	*bearer.Token
+	kind string
+	// refreshToken is a sealed login session, empty if refresh is disabled.
+	refreshToken   string
+	sessionExpires time.Time
+	// ExpiresAt is the time the token expires at. The end of the current
+	// epoch is unknown, so it's not later than the actual expiration.
+	ExpiresAt time.Time
 }
 
-func (u *Authenticator) getBearerToken(ctx context.Context, email string) (string, string, error) {
+func (u *Authenticator) getToken(ctx context.Context, issuer *issuer, kind string, params bearer.Params) (*issuedToken, error) {
 	infoRes, err := u.sdkPool.NetworkInfo(ctx, client.PrmNetworkInfo{})
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	msPerEpoch := infoRes.MsPerBlock() * int64(infoRes.EpochDuration())
-	return u.generator.NewBearer(email, infoRes.CurrentEpoch(), msPerEpoch)
+	var (
+		currentEpoch = infoRes.CurrentEpoch()
+		msPerEpoch   = infoRes.MsPerBlock() * int64(infoRes.EpochDuration())
+	)
+	token, err := issuer.issue(kind, params, currentEpoch, msPerEpoch)
+	if err != nil {
+		return nil, err
+	}
+
+	lifetime := time.Duration(token.Expiration-currentEpoch) * time.Duration(msPerEpoch) * time.Millisecond
+	return &issuedToken{Token: token, kind: kind, ExpiresAt: time.Now().Add(lifetime)}, nil
+}
+
+// forbidden responds with access denied page.
+func (u *Authenticator) forbidden(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	if _, err := fmt.Fprint(w, forbiddenHTML); err != nil {
+		u.log.Error("couldn't write forbidden page", zap.Error(err))
+	}
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
 }
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nspcc-dev/neo-go/pkg/crypto/keys"
+	"github.com/nspcc-dev/neofs-oauthz/bearer"
+	"github.com/nspcc-dev/neofs-sdk-go/client"
+	cidtest "github.com/nspcc-dev/neofs-sdk-go/container/id/test"
+	"github.com/nspcc-dev/neofs-sdk-go/netmap"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+const (
+	testService = "test"
+	testEmail   = "user@example.com"
+)
+
+// testNetwork is a NeoFS network with fixed parameters.
+type testNetwork struct{}
+
+func (testNetwork) NetworkInfo(context.Context, client.PrmNetworkInfo) (netmap.NetworkInfo, error) {
+	var info netmap.NetworkInfo
+	info.SetCurrentEpoch(100)
+	info.SetMsPerBlock(1000)
+	info.SetEpochDuration(240)
+	return info, nil
+}
+
+// testIdP is an OAuth 2.0 service issuing access and rotated refresh tokens
+// for any authorization code.
+type testIdP struct {
+	*httptest.Server
+
+	m sync.Mutex
+	// refreshTokens are valid refresh tokens.
+	refreshTokens map[string]bool
+	issued        int
+	// refreshStatus is returned on refresh requests if set.
+	refreshStatus int
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	idp := &testIdP{refreshTokens: make(map[string]bool)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer access-") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"email": testEmail, "email_verified": true, "sub": "42"})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (p *testIdP) token(w http.ResponseWriter, r *http.Request) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+	case "refresh_token":
+		if p.refreshStatus != 0 {
+			w.WriteHeader(p.refreshStatus)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "temporarily_unavailable"})
+			return
+		}
+		refreshToken := r.PostFormValue("refresh_token")
+		if !p.refreshTokens[refreshToken] {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		delete(p.refreshTokens, refreshToken)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	p.issued++
+	refreshToken := "refresh-" + strconv.Itoa(p.issued)
+	p.refreshTokens[refreshToken] = true
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token":  "access-" + strconv.Itoa(p.issued),
+		"token_type":    "Bearer",
+		"expires_in":    3600,
+		"refresh_token": refreshToken,
+	})
+}
+
+// revoke makes all refresh tokens invalid.
+func (p *testIdP) revoke() {
+	p.m.Lock()
+	defer p.m.Unlock()
+	clear(p.refreshTokens)
+}
+
+func (p *testIdP) setRefreshStatus(status int) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.refreshStatus = status
+}
+
+// newTestAuthenticator creates authenticator with the test service and
+// memory stores, modify can change the config before creation.
+func newTestAuthenticator(t *testing.T, idp *testIdP, modify func(*Config)) *Authenticator {
+	key, err := keys.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, err := NewServiceConfig(context.Background(), testService, ServiceParams{
+		Type: ServiceGeneric,
+		Oauth: &oauth2.Config{
+			ClientID:     "client",
+			ClientSecret: "secret",
+			RedirectURL:  "https://oauthz.example.com/callback",
+			Endpoint: oauth2.Endpoint{
+				AuthURL:   idp.URL + "/authorize",
+				TokenURL:  idp.URL + "/token",
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+		},
+		UserInfo: UserInfoParams{
+			URL:               idp.URL + "/userinfo",
+			EmailVerifiedPath: "email_verified",
+			SubjectPath:       "sub",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{
+		Bearer: &bearer.Config{
+			EmailAttr:         "Email",
+			Key:               key,
+			ContainerID:       cidtest.ID(),
+			LifeTime:          10,
+			MaxObjectSize:     1 << 20,
+			ObjectMaxLifetime: time.Hour,
+		},
+		BearerCookieName: "Bearer",
+		Oauth:            map[string]*ServiceOauth{testService: service},
+		RedirectURL:      "/",
+		StateStorage:     NewMemoryStateStorage(time.Minute, 100),
+		StateTTL:         time.Minute,
+		Device:           DeviceConfig{CodeTTL: time.Minute, Store: NewMemoryStore(100)},
+		Loopback:         LoopbackConfig{CodeTTL: time.Minute, Store: NewMemoryStore(100)},
+	}
+	if modify != nil {
+		modify(config)
+	}
+	a, err := New(zap.NewNop(), testNetwork{}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// logIn starts login with the query and completes it with the callback made
+// with the header, callback response is returned.
+func logIn(t *testing.T, a *Authenticator, query url.Values, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	query.Set("service", testService)
+	w := httptest.NewRecorder()
+	a.LogInWith(w, httptest.NewRequest(http.MethodGet, "/login?"+query.Encode(), nil))
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("login: unexpected status %d: %s", w.Code, w.Body)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback := url.Values{"state": {location.Query().Get("state")}, "code": {"code"}}
+	r := httptest.NewRequest(http.MethodGet, "/callback?"+callback.Encode(), nil)
+	for _, cookie := range w.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	for key, values := range header {
+		r.Header[key] = values
+	}
+	w = httptest.NewRecorder()
+	a.Callback(w, r)
+	return w
+}
+
+// postForm calls the handler with POST form request.
+func postForm(handler http.HandlerFunc, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// decodeResponse checks response status and decodes JSON body into v.
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder, status int, v any) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, w.Code, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body, err)
+	}
+}
+
+// checkErrorResponse checks that response is an error with the code.
+func checkErrorResponse(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	var res errorResponse
+	decodeResponse(t, w, status, &res)
+	if res.Error != code {
+		t.Fatalf("expected error %s, got %+v", code, res)
+	}
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// stateCookieName is a name of the cookie binding oauth state to the browser
+// the login was started in.
+const stateCookieName = "oauthz_state"
+
+// CookieConfig contains attributes of token and attribute cookies.
+type CookieConfig struct {
+	Secure   bool
+	HTTPOnly bool
+	// SameSite is http.SameSiteLaxMode if unset.
+	SameSite http.SameSite
+	Domain   string
+	// Path is "/" if empty.
+	Path string
+}
+
+func (c *CookieConfig) validate() error {
+	if c.SameSite == http.SameSiteNoneMode && !c.Secure {
+		return errors.New("cookies with SameSite=None must be secure")
+	}
+	return nil
+}
+
+// setTokenCookies sets cookies with the token and attribute values expiring
+// along with the token.
+func (u *Authenticator) setTokenCookies(w http.ResponseWriter, token *issuedToken) {
+	maxAge := max(int(time.Until(token.ExpiresAt)/time.Second), 1)
+	cfg := u.config.Cookie
+	sameSite := cfg.SameSite
+	if sameSite == http.SameSiteDefaultMode {
+		sameSite = http.SameSiteLaxMode
+	}
+
+	set := func(name, value string) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    value,
+			Path:     cmp.Or(cfg.Path, "/"),
+			Domain:   cfg.Domain,
+			Expires:  token.ExpiresAt,
+			MaxAge:   maxAge,
+			Secure:   cfg.Secure,
+			HttpOnly: cfg.HTTPOnly,
+			SameSite: sameSite,
+		})
+	}
+
+	set(u.config.BearerCookieName, token.Value)
+	if token.Identity != "" {
+		set("X-Attribute-Email", token.Identity)
+	}
+	for name, value := range token.Attributes {
+		set("X-Attribute-"+name, value)
+	}
+
+	if token.refreshToken != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     refreshCookieName,
+			Value:    token.refreshToken,
+			Path:     cmp.Or(cfg.Path, "/"),
+			Domain:   cfg.Domain,
+			Expires:  token.sessionExpires,
+			MaxAge:   max(int(time.Until(token.sessionExpires)/time.Second), 1),
+			Secure:   cfg.Secure,
+			HttpOnly: true,
+			SameSite: sameSite,
+		})
+	}
+}
+
+// setStateCookie binds the state to the user agent. Services sending
+// callbacks as cross-site POST requests need the cookie to be sent with them,
+// so it's not restricted by SameSite policy for them.
+func (u *Authenticator) setStateCookie(w http.ResponseWriter, state string, formPost bool) {
+	cookie := &http.Cookie{
+		Name:     stateCookieName,
+		Value:    stateHash(state),
+		Path:     "/",
+		MaxAge:   int(u.config.StateTTL / time.Second),
+		Secure:   u.config.TLSEnabled,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if formPost {
+		cookie.Secure = true // required by browsers for SameSite=None
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(w, cookie)
+}
+
+// checkStateCookie checks that the state is bound to the user agent and
+// removes the binding since the state can be used once only.
+func (u *Authenticator) checkStateCookie(w http.ResponseWriter, r *http.Request, state string) bool {
+	cookie, err := r.Cookie(stateCookieName)
+	if err != nil {
+		return false
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   u.config.TLSEnabled,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateHash(state))) == 1
+}
+
+func stateHash(state string) string {
+	h := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckStateCookie(t *testing.T) {
+	a := &Authenticator{config: &Config{}}
+	const state = "state"
+
+	for _, tc := range []struct {
+		name   string
+		cookie *http.Cookie
+		state  string
+		valid  bool
+	}{
+		{name: "matching", cookie: &http.Cookie{Name: stateCookieName, Value: stateHash(state)}, state: state, valid: true},
+		{name: "another state", cookie: &http.Cookie{Name: stateCookieName, Value: stateHash("other")}, state: state},
+		{name: "raw state", cookie: &http.Cookie{Name: stateCookieName, Value: state}, state: state},
+		{name: "empty cookie", cookie: &http.Cookie{Name: stateCookieName}, state: state},
+		{name: "empty state", cookie: &http.Cookie{Name: stateCookieName, Value: stateHash(state)}},
+		{name: "no cookie", state: state},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/callback", nil)
+			if tc.cookie != nil {
+				r.AddCookie(tc.cookie)
+			}
+			w := httptest.NewRecorder()
+			if valid := a.checkStateCookie(w, r, tc.state); valid != tc.valid {
+				t.Fatalf("expected %t, got %t", tc.valid, valid)
+			}
+			if tc.cookie == nil {
+				return
+			}
+			// The cookie is removed after any check, so it can't be used again.
+			cookies := w.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Name != stateCookieName || cookies[0].MaxAge >= 0 {
+				t.Fatalf("state cookie must be removed, got %v", cookies)
+			}
+		})
+	}
+}
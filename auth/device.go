@@ -0,0 +1,397 @@
+package auth
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DeviceGrantType is a grant type of device access token requests.
+const DeviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Error codes of device access token responses.
+const (
+	errCodeAuthorizationPending = "authorization_pending"
+	errCodeSlowDown             = "slow_down"
+	errCodeExpiredToken         = "expired_token"
+)
+
+// slowDownStep is added to polling interval of the client polling too often.
+const slowDownStep = 5 * time.Second
+
+// userCodeAlphabet contains characters of user codes, vowels and similar
+// looking characters are excluded.
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+var errInvalidUserCode = errors.New("invalid or expired user code")
+
+var (
+	//go:embed static/device.html
+	deviceHTML     string
+	deviceTemplate = template.Must(template.New("device").Parse(deviceHTML))
+	//go:embed static/device_done.html
+	deviceDoneHTML string
+)
+
+// DeviceConfig contains parameters of device authorization flow.
+type DeviceConfig struct {
+	// CodeTTL is a time given to a user to complete login.
+	CodeTTL time.Duration
+	// Interval is a minimal interval between token requests of a client.
+	Interval time.Duration
+	// Store keeps pending device authorizations.
+	Store Store
+	// VerificationURI is a URL of device verification page, it's derived
+	// from the request if empty.
+	VerificationURI string
+}
+
+// Prefixes of device store keys. Every key is written by one side of the flow
+// only, so concurrent polls and login completion don't overwrite each other.
+const (
+	deviceKeyPrefix       = "device/"
+	userCodeKeyPrefix     = "user_code/"
+	devicePollKeyPrefix   = "device_poll/"
+	deviceResultKeyPrefix = "device_result/"
+)
+
+// deviceAuth is a pending device authorization, it's not changed after
+// creation.
+type deviceAuth struct {
+	DeviceCode string `json:"device_code"`
+	UserCode   string `json:"user_code"`
+	// Request contains parameters of the requested token.
+	Request  *LoginState   `json:"request"`
+	Expires  time.Time     `json:"expires"`
+	Interval time.Duration `json:"interval"`
+}
+
+// devicePoll is a polling state of the client, it's written by polls only.
+type devicePoll struct {
+	LastPoll time.Time     `json:"last_poll"`
+	Interval time.Duration `json:"interval"`
+}
+
+// deviceResult is a login result, either Token or Error is set. It's written
+// once on login completion.
+type deviceResult struct {
+	Token       *tokenResponse `json:"token,omitempty"`
+	Error       *errorResponse `json:"error,omitempty"`
+	ErrorStatus int            `json:"error_status,omitempty"`
+}
+
+// deviceStore keeps pending device authorizations in Store. Authorizations
+// are kept for CodeTTL after expiration to report it to polling clients.
+type deviceStore struct {
+	config DeviceConfig
+}
+
+func newDeviceStore(config DeviceConfig) *deviceStore {
+	if config.Store == nil {
+		config.Store = NewMemoryStore(defaultStoreCapacity)
+	}
+	return &deviceStore{config: config}
+}
+
+// add saves new authorization of the token requested.
+func (s *deviceStore) add(request *LoginState) (*deviceAuth, error) {
+	userCode := newUserCode()
+	for {
+		_, err := s.config.Store.Get(userCodeKeyPrefix + userCode)
+		if errors.Is(err, ErrNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		userCode = newUserCode()
+	}
+
+	device := &deviceAuth{
+		DeviceCode: randomString() + randomString(),
+		UserCode:   userCode,
+		Request:    request,
+		Expires:    time.Now().Add(s.config.CodeTTL),
+		Interval:   s.config.Interval,
+	}
+	if err := s.put(deviceKeyPrefix+device.DeviceCode, device, device); err != nil {
+		return nil, err
+	}
+	if err := s.config.Store.Put(userCodeKeyPrefix+userCode, []byte(device.DeviceCode), s.config.CodeTTL); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// request returns parameters of the token requested by authorization with
+// the user code. User code is valid until login is completed.
+func (s *deviceStore) request(userCode string) (*LoginState, error) {
+	deviceCode, err := s.config.Store.Get(userCodeKeyPrefix + normalizeUserCode(userCode))
+	if err != nil {
+		return nil, errInvalidUserCode
+	}
+	device, err := s.load(string(deviceCode))
+	if err != nil {
+		return nil, errInvalidUserCode
+	}
+	return device.Request, nil
+}
+
+// complete saves login result of authorization with the user code. User code
+// is taken from the store, so only one login completes the authorization.
+func (s *deviceStore) complete(userCode string, token *issuedToken, lErr *loginError) error {
+	deviceCode, err := s.config.Store.Take(userCodeKeyPrefix + normalizeUserCode(userCode))
+	if err != nil {
+		return errInvalidUserCode
+	}
+	device, err := s.load(string(deviceCode))
+	if err != nil {
+		return errInvalidUserCode
+	}
+
+	result := new(deviceResult)
+	if lErr != nil {
+		result.Error = &errorResponse{Error: lErr.code, Description: lErr.message}
+		result.ErrorStatus = lErr.status
+	} else {
+		result.Token = newTokenResponse(token)
+	}
+	return s.put(deviceResultKeyPrefix+device.DeviceCode, device, result)
+}
+
+// poll returns issued token or error of the authorization with the device
+// code. Authorization is removed once the result is returned.
+func (s *deviceStore) poll(deviceCode string) (*tokenResponse, *loginError) {
+	device, err := s.load(deviceCode)
+	if err != nil {
+		return nil, newLoginError(http.StatusBadRequest, errCodeInvalidGrant, "invalid device code", err)
+	}
+
+	now := time.Now()
+	if now.After(device.Expires) {
+		return nil, newLoginError(http.StatusBadRequest, errCodeExpiredToken, "device code is expired", nil)
+	}
+
+	// Only one of concurrent requests gets the result.
+	data, err := s.config.Store.Take(deviceResultKeyPrefix + deviceCode)
+	if err == nil {
+		_, _ = s.config.Store.Take(deviceKeyPrefix + deviceCode)
+		_, _ = s.config.Store.Take(devicePollKeyPrefix + deviceCode)
+		result := new(deviceResult)
+		if err = json.Unmarshal(data, result); err != nil {
+			return nil, newLoginError(http.StatusInternalServerError, errCodeServerError, err.Error(), err)
+		}
+		if result.Error != nil {
+			return nil, newLoginError(result.ErrorStatus, result.Error.Error, result.Error.Description, nil)
+		}
+		return result.Token, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, newLoginError(http.StatusServiceUnavailable, errCodeServerError, err.Error(), err)
+	}
+
+	state := &devicePoll{Interval: device.Interval}
+	if data, err = s.config.Store.Get(devicePollKeyPrefix + deviceCode); err == nil {
+		_ = json.Unmarshal(data, state)
+	}
+	slowDown := now.Sub(state.LastPoll) < state.Interval
+	if slowDown {
+		state.Interval += slowDownStep
+	}
+	state.LastPoll = now
+	if err = s.put(devicePollKeyPrefix+deviceCode, device, state); err != nil {
+		return nil, newLoginError(http.StatusServiceUnavailable, errCodeServerError, err.Error(), err)
+	}
+	if slowDown {
+		return nil, newLoginError(http.StatusBadRequest, errCodeSlowDown, "polling too frequently", nil)
+	}
+	return nil, newLoginError(http.StatusBadRequest, errCodeAuthorizationPending, "authorization is pending", nil)
+}
+
+func (s *deviceStore) load(deviceCode string) (*deviceAuth, error) {
+	data, err := s.config.Store.Get(deviceKeyPrefix + deviceCode)
+	if err != nil {
+		return nil, err
+	}
+	device := new(deviceAuth)
+	if err = json.Unmarshal(data, device); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// put saves value of the authorization under the key.
+func (s *deviceStore) put(key string, device *deviceAuth, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.config.Store.Put(key, data, time.Until(device.Expires)+s.config.CodeTTL)
+}
+
+// newUserCode generates user code in XXXX-XXXX format.
+func newUserCode() string {
+	var (
+		b    = make([]byte, 1)
+		code = make([]byte, 0, 9)
+		// limit excludes bytes biasing the choice of characters.
+		limit = byte(256 - 256%len(userCodeAlphabet))
+	)
+	for len(code) < cap(code) {
+		if len(code) == 4 {
+			code = append(code, '-')
+			continue
+		}
+		_, _ = rand.Read(b)
+		if b[0] >= limit {
+			continue
+		}
+		code = append(code, userCodeAlphabet[int(b[0])%len(userCodeAlphabet)])
+	}
+	return string(code)
+}
+
+// normalizeUserCode converts user code entered by the user to the generated
+// format.
+func normalizeUserCode(userCode string) string {
+	code := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(userCode))
+	if len(code) != 8 {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
+
+// deviceCodeResponse is a device authorization response.
+type deviceCodeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceCode is a device authorization request handler. It accepts the same
+// token parameters as LogInWith.
+func (u *Authenticator) DeviceCode(w http.ResponseWriter, r *http.Request) {
+	if !u.requirePost(w, r) {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		u.writeJSON(w, http.StatusBadRequest, &errorResponse{Error: errCodeInvalidRequest, Description: err.Error()})
+		return
+	}
+
+	request := new(LoginState)
+	if err := u.setTokenRequest(request, r.Form); err != nil {
+		u.log.Error("invalid device token request", zap.Error(err))
+		u.writeJSON(w, http.StatusBadRequest, &errorResponse{Error: errCodeInvalidRequest, Description: err.Error()})
+		return
+	}
+
+	device, err := u.devices.add(request)
+	if err != nil {
+		u.log.Error("couldn't save device authorization", zap.Error(err))
+		u.writeJSON(w, http.StatusServiceUnavailable, &errorResponse{Error: errCodeServerError, Description: err.Error()})
+		return
+	}
+
+	verificationURI := u.verificationURI(r)
+	u.writeJSON(w, http.StatusOK, &deviceCodeResponse{
+		DeviceCode:              device.DeviceCode,
+		UserCode:                device.UserCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?" + url.Values{"user_code": {device.UserCode}}.Encode(),
+		ExpiresIn:               int(u.config.Device.CodeTTL.Seconds()),
+		Interval:                int(device.Interval.Seconds()),
+	})
+}
+
+// Device is a device verification page handler.
+func (u *Authenticator) Device(w http.ResponseWriter, r *http.Request) {
+	services := make([]string, 0, len(u.config.Oauth))
+	for name := range u.config.Oauth {
+		services = append(services, name)
+	}
+	slices.Sort(services)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := deviceTemplate.Execute(w, struct {
+		UserCode string
+		Services []string
+	}{
+		UserCode: r.URL.Query().Get("user_code"),
+		Services: services,
+	})
+	if err != nil {
+		u.log.Error("couldn't write device page", zap.Error(err))
+	}
+}
+
+// DeviceToken is a device access token request handler.
+func (u *Authenticator) DeviceToken(w http.ResponseWriter, r *http.Request) {
+	if !u.requirePost(w, r) {
+		return
+	}
+	if grantType := r.PostFormValue("grant_type"); grantType != DeviceGrantType {
+		u.writeJSON(w, http.StatusBadRequest, &errorResponse{
+			Error:       errCodeUnsupportedGrantType,
+			Description: "grant_type must be " + DeviceGrantType,
+		})
+		return
+	}
+
+	token, lErr := u.devices.poll(r.PostFormValue("device_code"))
+	if lErr != nil {
+		u.writeError(w, lErr)
+		return
+	}
+	u.writeJSON(w, http.StatusOK, token)
+}
+
+// completeDevice saves login result for the device and responds to the user.
+func (u *Authenticator) completeDevice(w http.ResponseWriter, login *LoginState, token *issuedToken, lErr *loginError) {
+	if err := u.devices.complete(login.UserCode, token, lErr); err != nil {
+		u.log.Error("couldn't complete device authorization", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if lErr != nil {
+		if lErr.code == errCodeAccessDenied {
+			u.forbidden(w)
+			return
+		}
+		http.Error(w, lErr.message, lErr.status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write([]byte(deviceDoneHTML)); err != nil {
+		u.log.Error("couldn't write device page", zap.Error(err))
+	}
+}
+
+func (u *Authenticator) verificationURI(r *http.Request) string {
+	if u.config.Device.VerificationURI != "" {
+		return u.config.Device.VerificationURI
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/device"
+}
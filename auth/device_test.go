@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startDevice(t *testing.T, a *Authenticator) *deviceCodeResponse {
+	t.Helper()
+	res := new(deviceCodeResponse)
+	decodeResponse(t, postForm(a.DeviceCode, url.Values{}), http.StatusOK, res)
+	return res
+}
+
+func pollDevice(a *Authenticator, deviceCode string) *httptest.ResponseRecorder {
+	return postForm(a.DeviceToken, url.Values{"grant_type": {DeviceGrantType}, "device_code": {deviceCode}})
+}
+
+func TestDeviceFlow(t *testing.T) {
+	a := newTestAuthenticator(t, newTestIdP(t), nil)
+	device := startDevice(t, a)
+
+	checkErrorResponse(t, pollDevice(a, device.DeviceCode), http.StatusBadRequest, errCodeAuthorizationPending)
+
+	// User code is accepted as typed by the user.
+	userCode := strings.ToLower(strings.ReplaceAll(device.UserCode, "-", ""))
+	if w := logIn(t, a, url.Values{"user_code": {userCode}}, nil); w.Code != http.StatusOK {
+		t.Fatalf("unexpected callback status %d: %s", w.Code, w.Body)
+	}
+
+	var token tokenResponse
+	decodeResponse(t, pollDevice(a, device.DeviceCode), http.StatusOK, &token)
+	if token.Bearer == "" || token.TokenType != TokenBearer {
+		t.Fatalf("unexpected token %+v", token)
+	}
+
+	checkErrorResponse(t, pollDevice(a, device.DeviceCode), http.StatusBadRequest, errCodeInvalidGrant)
+	w := httptest.NewRecorder()
+	a.LogInWith(w, httptest.NewRequest(http.MethodGet, "/login?service=test&user_code="+device.UserCode, nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("completed user code must be rejected, got %d", w.Code)
+	}
+}
+
+func TestDeviceSlowDown(t *testing.T) {
+	a := newTestAuthenticator(t, newTestIdP(t), func(c *Config) {
+		c.Device.Interval = time.Hour
+	})
+	device := startDevice(t, a)
+
+	checkErrorResponse(t, pollDevice(a, device.DeviceCode), http.StatusBadRequest, errCodeAuthorizationPending)
+	checkErrorResponse(t, pollDevice(a, device.DeviceCode), http.StatusBadRequest, errCodeSlowDown)
+}
+
+func TestDeviceConcurrentPolls(t *testing.T) {
+	a := newTestAuthenticator(t, newTestIdP(t), nil)
+	device := startDevice(t, a)
+
+	const pollers = 8
+	var (
+		wg      sync.WaitGroup
+		results = make([]*httptest.ResponseRecorder, pollers)
+	)
+	for i := range pollers {
+		wg.Go(func() {
+			for {
+				w := pollDevice(a, device.DeviceCode)
+				body := w.Body.String()
+				if w.Code != http.StatusBadRequest || !strings.Contains(body, errCodeAuthorizationPending) && !strings.Contains(body, errCodeSlowDown) {
+					results[i] = w
+					return
+				}
+			}
+		})
+	}
+
+	w := logIn(t, a, url.Values{"user_code": {device.UserCode}}, nil)
+	wg.Wait()
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected callback status %d: %s", w.Code, w.Body)
+	}
+
+	var tokens int
+	for _, w := range results {
+		if w.Code == http.StatusOK {
+			tokens++
+			continue
+		}
+		checkErrorResponse(t, w, http.StatusBadRequest, errCodeInvalidGrant)
+	}
+	if tokens != 1 {
+		t.Fatalf("token must be delivered exactly once, got %d", tokens)
+	}
+}
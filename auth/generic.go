@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Supported styles of passing access token to user info endpoint.
+const (
+	AuthStyleBearer = "bearer"
+	AuthStyleToken  = "token"
+	AuthStyleQuery  = "query"
+)
+
+const defaultEmailPath = "email"
+
+// UserInfoParams describes user info endpoint of a generic OAuth 2.0 service.
+type UserInfoParams struct {
+	URL string
+	// AuthStyle is a way to pass access token, AuthStyleBearer if empty.
+	AuthStyle string
+	// EmailPath is a path to user email in the response, "email" if empty.
+	EmailPath string
+	// EmailVerifiedPath is a path to boolean flag that must be set for the
+	// email to be accepted. Required unless TrustUnverifiedEmail is set.
+	EmailVerifiedPath string
+	// TrustUnverifiedEmail makes any returned email accepted if there is no
+	// EmailVerifiedPath. Only for services not allowing users to set emails
+	// they don't own.
+	TrustUnverifiedEmail bool
+	// SubjectPath is a path to user ID in the response, optional.
+	SubjectPath string
+	// GroupsPath is a path to array of user groups in the response, optional.
+	GroupsPath string
+	// NamePath is a path to user display name in the response, optional.
+	NamePath string
+}
+
+// Paths are either JSON pointers (RFC 6901) like "/data/email" or dot
+// separated keys like "data.email". Array elements are addressed by index.
+type jsonPath []string
+
+func newGenericUserInfo(params UserInfoParams) (userInfoFn, userInfoParser, error) {
+	if params.URL == "" {
+		return nil, nil, fmt.Errorf("user info url is not set")
+	}
+	if _, err := url.Parse(params.URL); err != nil {
+		return nil, nil, fmt.Errorf("invalid user info url: %w", err)
+	}
+
+	var fn userInfoFn
+	switch params.AuthStyle {
+	case "", AuthStyleBearer:
+		fn = headerRequest(params.URL, "Bearer ")
+	case AuthStyleToken:
+		fn = headerRequest(params.URL, "token ")
+	case AuthStyleQuery:
+		fn = queryRequest(params.URL)
+	default:
+		return nil, nil, fmt.Errorf("unsupported auth style '%s'", params.AuthStyle)
+	}
+
+	if params.EmailVerifiedPath == "" && !params.TrustUnverifiedEmail {
+		return nil, nil, fmt.Errorf("email verified path is not set")
+	}
+	if params.EmailPath == "" {
+		params.EmailPath = defaultEmailPath
+	}
+	var (
+		emailPath    = parseJSONPath(params.EmailPath)
+		verifiedPath = parseJSONPath(params.EmailVerifiedPath)
+		subjectPath  = parseJSONPath(params.SubjectPath)
+		groupsPath   = parseJSONPath(params.GroupsPath)
+		namePath     = parseJSONPath(params.NamePath)
+	)
+
+	parse := func(data []byte) (*Identity, error) {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+
+		var info any
+		if err := dec.Decode(&info); err != nil {
+			return nil, err
+		}
+
+		email, _ := emailPath.lookup(info).(string)
+		if email == "" {
+			return nil, errUnverifiedEmail
+		}
+		if len(verifiedPath) != 0 {
+			if verified, _ := verifiedPath.lookup(info).(bool); !verified {
+				return nil, errUnverifiedEmail
+			}
+		}
+
+		user := &Identity{Email: email}
+		if len(subjectPath) != 0 {
+			switch subject := subjectPath.lookup(info).(type) {
+			case string:
+				user.Subject = subject
+			case json.Number:
+				user.Subject = subject.String()
+			}
+		}
+		if len(namePath) != 0 {
+			user.Name, _ = namePath.lookup(info).(string)
+		}
+		if len(groupsPath) != 0 {
+			groups, _ := groupsPath.lookup(info).([]any)
+			for _, group := range groups {
+				if s, ok := group.(string); ok {
+					user.Groups = append(user.Groups, s)
+				}
+			}
+		}
+		return user, nil
+	}
+
+	return fn, parse, nil
+}
+
+func headerRequest(url, prefix string) userInfoFn {
+	return func(token string) (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", prefix+token)
+		return req, nil
+	}
+}
+
+func queryRequest(rawURL string) userInfoFn {
+	return func(token string) (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		query := req.URL.Query()
+		query.Set("access_token", token)
+		req.URL.RawQuery = query.Encode()
+		return req, nil
+	}
+}
+
+func parseJSONPath(s string) jsonPath {
+	switch {
+	case s == "":
+		return nil
+	case strings.HasPrefix(s, "/"):
+		keys := strings.Split(s[1:], "/")
+		for i := range keys {
+			keys[i] = strings.ReplaceAll(strings.ReplaceAll(keys[i], "~1", "/"), "~0", "~")
+		}
+		return keys
+	default:
+		return strings.Split(s, ".")
+	}
+}
+
+// lookup returns value at the path or nil if there is no such value.
+func (p jsonPath) lookup(v any) any {
+	for _, key := range p {
+		switch node := v.(type) {
+		case map[string]any:
+			v = node[key]
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			v = node[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
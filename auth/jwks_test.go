@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// jwksServer serves JSON Web Key Set which can be changed between requests.
+type jwksServer struct {
+	*httptest.Server
+
+	m        sync.Mutex
+	keys     []jwk
+	requests int
+}
+
+func newJWKSServer(t *testing.T, keys ...jwk) *jwksServer {
+	s := &jwksServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		s.m.Lock()
+		defer s.m.Unlock()
+		s.requests++
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) setKeys(keys ...jwk) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.keys = keys
+}
+
+func (s *jwksServer) requestCount() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.requests
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) jwk {
+	return jwk{
+		KeyType: "RSA",
+		KeyID:   kid,
+		Use:     "sig",
+		N:       base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) jwk {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	x, y := make([]byte, size), make([]byte, size)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	return jwk{
+		KeyType: "EC",
+		KeyID:   kid,
+		Curve:   key.Curve.Params().Name,
+		X:       base64.RawURLEncoding.EncodeToString(x),
+		Y:       base64.RawURLEncoding.EncodeToString(y),
+	}
+}
+
+func TestKeySetKey(t *testing.T) {
+	encKey := rsaJWK("enc", &testKeys.rsa2.PublicKey)
+	encKey.Use = "enc"
+	badCurve := ecJWK("bad-curve", &testKeys.p256.PublicKey)
+	badCurve.Curve = "secp256k1"
+
+	server := newJWKSServer(t,
+		rsaJWK("rsa", &testKeys.rsa.PublicKey),
+		ecJWK("p256", &testKeys.p256.PublicKey),
+		ecJWK("p384", &testKeys.p384.PublicKey),
+		encKey,
+		badCurve,
+		jwk{KeyType: "oct", KeyID: "oct"},
+	)
+	keys := newKeySet(server.URL)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		kid string
+		err string
+	}{
+		{kid: "rsa"},
+		{kid: "p256"},
+		{kid: "p384"},
+		{kid: "enc", err: "unknown jwk"},
+		{kid: "bad-curve", err: "unknown jwk"},
+		{kid: "oct", err: "unknown jwk"},
+		{kid: "", err: "unknown jwk"}, // several keys
+		{kid: "missing", err: "unknown jwk"},
+	} {
+		t.Run(tc.kid, func(t *testing.T) {
+			_, err := keys.key(ctx, tc.kid)
+			checkErr(t, err, tc.err)
+		})
+	}
+	if n := server.requestCount(); n != 1 {
+		t.Fatalf("unknown keys must not refetch set more often than once a %s, got %d requests", jwksRefreshInterval, n)
+	}
+}
+
+func TestKeySetVerify(t *testing.T) {
+	server := newJWKSServer(t,
+		rsaJWK("rsa", &testKeys.rsa.PublicKey),
+		ecJWK("p256", &testKeys.p256.PublicKey),
+	)
+	keys := newKeySet(server.URL)
+	claims := map[string]string{"sub": "user"}
+
+	for _, tc := range []struct {
+		name string
+		raw  string
+		err  string
+	}{
+		{name: "rsa", raw: signJWT(t, "RS256", "rsa", testKeys.rsa, claims)},
+		{name: "ec", raw: signJWT(t, "ES256", "p256", testKeys.p256, claims)},
+		{name: "ec algorithm with rsa kid", raw: signJWT(t, "ES256", "rsa", testKeys.p256, claims), err: "doesn't match algorithm"},
+		{name: "rsa algorithm with ec kid", raw: signJWT(t, "RS256", "p256", testKeys.rsa, claims), err: "doesn't match algorithm"},
+		{name: "kid of another key", raw: signJWT(t, "RS256", "rsa", testKeys.rsa2, claims), err: errJWTSignature.Error()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := parseJWT(tc.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, err := keys.key(context.Background(), token.header.KeyID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkErr(t, token.verify(key), tc.err)
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	server := newJWKSServer(t, rsaJWK("old", &testKeys.rsa.PublicKey))
+	keys := newKeySet(server.URL)
+	ctx := context.Background()
+
+	// Single key is used for tokens without kid.
+	if _, err := keys.key(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	server.setKeys(rsaJWK("old", &testKeys.rsa.PublicKey), ecJWK("new", &testKeys.p256.PublicKey))
+	if _, err := keys.key(ctx, "new"); err == nil {
+		t.Fatal("set must not be refetched until refresh interval passes")
+	}
+
+	keys.fetchedAt = time.Now().Add(-jwksRefreshInterval)
+	key, err := keys.key(ctx, "new")
+	if err != nil {
+		t.Fatalf("rotated key must be fetched: %v", err)
+	}
+	if !testKeys.p256.PublicKey.Equal(key) {
+		t.Fatal("unexpected rotated key")
+	}
+	if _, err = keys.key(ctx, "old"); err != nil {
+		t.Fatalf("old key must be kept while it's in the set: %v", err)
+	}
+	if n := server.requestCount(); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+
+	// Cached keys are dropped on the next refetch triggered by an unknown one.
+	server.setKeys(ecJWK("new", &testKeys.p256.PublicKey), ecJWK("newer", &testKeys.p384.PublicKey))
+	keys.fetchedAt = time.Now().Add(-jwksRefreshInterval)
+	if _, err = keys.key(ctx, "newer"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = keys.key(ctx, "old"); err == nil {
+		t.Fatal("removed key must not be used after refetch")
+	}
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256" // register hash functions used by JWT algorithms
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// jwtHeader is a JOSE header of a signed JWT.
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// jwt is a parsed compact JWS with not yet verified payload.
+type jwt struct {
+	header    jwtHeader
+	payload   []byte
+	signed    []byte
+	signature []byte
+}
+
+var errJWTSignature = errors.New("invalid jwt signature")
+
+// parseJWT decodes compact serialized JWT without verifying it.
+func parseJWT(raw string) (*jwt, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed jwt: expected 3 parts, got %d", len(parts))
+	}
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt header: %w", err)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt payload: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt signature: %w", err)
+	}
+
+	t := &jwt{
+		payload:   payload,
+		signed:    []byte(parts[0] + "." + parts[1]),
+		signature: signature,
+	}
+	if err = json.Unmarshal(header, &t.header); err != nil {
+		return nil, fmt.Errorf("malformed jwt header: %w", err)
+	}
+
+	return t, nil
+}
+
+// verify checks JWT signature using the public key.
+func (t *jwt) verify(key crypto.PublicKey) error {
+	hash, err := jwtHash(t.header.Algorithm)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write(t.signed)
+	digest := h.Sum(nil)
+
+	switch t.header.Algorithm[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type %T doesn't match algorithm %s", key, t.header.Algorithm)
+		}
+		if t.header.Algorithm[0] == 'R' {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, t.signature)
+		} else {
+			err = rsa.VerifyPSS(pub, hash, digest, t.signature, nil)
+		}
+		if err != nil {
+			return errJWTSignature
+		}
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type %T doesn't match algorithm %s", key, t.header.Algorithm)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(t.signature) != 2*size {
+			return errJWTSignature
+		}
+		r := new(big.Int).SetBytes(t.signature[:size])
+		s := new(big.Int).SetBytes(t.signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errJWTSignature
+		}
+	}
+
+	return nil
+}
+
+func jwtHash(alg string) (crypto.Hash, error) {
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		return crypto.SHA256, nil
+	case "RS384", "PS384", "ES384":
+		return crypto.SHA384, nil
+	case "RS512", "PS512", "ES512":
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("unsupported jwt algorithm '%s'", alg)
+	}
+}
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// testKeys are keys generated once for all tests, RSA key generation is slow.
+var testKeys = struct {
+	rsa, rsa2 *rsa.PrivateKey
+	p256      *ecdsa.PrivateKey
+	p384      *ecdsa.PrivateKey
+}{
+	rsa:  mustRSAKey(),
+	rsa2: mustRSAKey(),
+	p256: mustECKey(elliptic.P256()),
+	p384: mustECKey(elliptic.P384()),
+}
+
+func mustRSAKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func mustECKey(curve elliptic.Curve) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// signJWT creates compact JWT with the claims signed by the key using alg.
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims any) string {
+	t.Helper()
+
+	header, err := json.Marshal(jwtHeader{Algorithm: alg, KeyID: kid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	hash, err := jwtHash(alg)
+	if err != nil {
+		// Unsupported algorithms get a dummy signature.
+		return signed + "." + base64.RawURLEncoding.EncodeToString([]byte("signature"))
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if alg[0] == 'P' {
+			signature, err = rsa.SignPSS(rand.Reader, k, hash, digest, nil)
+		} else {
+			signature, err = rsa.SignPKCS1v15(rand.Reader, k, hash, digest)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, signErr := ecdsa.Sign(rand.Reader, k, digest)
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+		err = signErr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerify(t *testing.T) {
+	claims := map[string]string{"sub": "user"}
+
+	for _, tc := range []struct {
+		name     string
+		alg      string
+		signer   crypto.Signer
+		verifier crypto.PublicKey
+		tamper   bool
+		err      string
+	}{
+		{name: "RS256", alg: "RS256", signer: testKeys.rsa, verifier: &testKeys.rsa.PublicKey},
+		{name: "RS512", alg: "RS512", signer: testKeys.rsa, verifier: &testKeys.rsa.PublicKey},
+		{name: "PS256", alg: "PS256", signer: testKeys.rsa, verifier: &testKeys.rsa.PublicKey},
+		{name: "ES256", alg: "ES256", signer: testKeys.p256, verifier: &testKeys.p256.PublicKey},
+		{name: "ES384", alg: "ES384", signer: testKeys.p384, verifier: &testKeys.p384.PublicKey},
+		{name: "another rsa key", alg: "RS256", signer: testKeys.rsa2, verifier: &testKeys.rsa.PublicKey, err: errJWTSignature.Error()},
+		{name: "another ec key", alg: "ES256", signer: mustECKey(elliptic.P256()), verifier: &testKeys.p256.PublicKey, err: errJWTSignature.Error()},
+		{name: "tampered payload", alg: "RS256", signer: testKeys.rsa, verifier: &testKeys.rsa.PublicKey, tamper: true, err: errJWTSignature.Error()},
+		{name: "PKCS1 signature as PSS", alg: "PS256", signer: testKeys.rsa, verifier: &testKeys.rsa.PublicKey, tamper: true, err: errJWTSignature.Error()},
+		{name: "ec algorithm with rsa key", alg: "ES256", signer: testKeys.p256, verifier: &testKeys.rsa.PublicKey, err: "doesn't match algorithm"},
+		{name: "rsa algorithm with ec key", alg: "RS256", signer: testKeys.rsa, verifier: &testKeys.p256.PublicKey, err: "doesn't match algorithm"},
+		{name: "curve size mismatch", alg: "ES384", signer: testKeys.p384, verifier: &testKeys.p256.PublicKey, err: errJWTSignature.Error()},
+		{name: "none", alg: "none", signer: testKeys.rsa, verifier: &testKeys.rsa.PublicKey, err: "unsupported jwt algorithm"},
+		{name: "HS256", alg: "HS256", signer: testKeys.rsa, verifier: &testKeys.rsa.PublicKey, err: "unsupported jwt algorithm"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			raw := signJWT(t, tc.alg, "", tc.signer, claims)
+			if tc.tamper {
+				parts := strings.Split(raw, ".")
+				if tc.alg[0] == 'P' {
+					// Replace PSS signature with PKCS #1 v1.5 one.
+					parts[2] = strings.Split(signJWT(t, "RS256", "", tc.signer, claims), ".")[2]
+				} else {
+					parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`))
+				}
+				raw = strings.Join(parts, ".")
+			}
+
+			token, err := parseJWT(raw)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			err = token.verify(tc.verifier)
+			checkErr(t, err, tc.err)
+		})
+	}
+}
+
+func TestParseJWT(t *testing.T) {
+	valid := signJWT(t, "ES256", "kid", testKeys.p256, map[string]string{"sub": "user"})
+	parts := strings.Split(valid, ".")
+
+	for _, tc := range []struct {
+		name string
+		raw  string
+		err  string
+	}{
+		{name: "valid", raw: valid},
+		{name: "two parts", raw: parts[0] + "." + parts[1], err: "expected 3 parts"},
+		{name: "four parts", raw: valid + ".", err: "expected 3 parts"},
+		{name: "padded header", raw: parts[0] + "=." + parts[1] + "." + parts[2], err: "malformed jwt header"},
+		{name: "bad payload", raw: parts[0] + ".!." + parts[2], err: "malformed jwt payload"},
+		{name: "bad signature", raw: parts[0] + "." + parts[1] + ".!", err: "malformed jwt signature"},
+		{name: "header not json", raw: base64.RawURLEncoding.EncodeToString([]byte("alg")) + "." + parts[1] + "." + parts[2], err: "malformed jwt header"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := parseJWT(tc.raw)
+			checkErr(t, err, tc.err)
+			if err == nil && (token.header.Algorithm != "ES256" || token.header.KeyID != "kid") {
+				t.Fatalf("unexpected header %+v", token.header)
+			}
+		})
+	}
+}
+
+// checkErr checks that err contains expected text, nil error is expected if
+// it's empty.
+func checkErr(t *testing.T, err error, expected string) {
+	t.Helper()
+	switch {
+	case expected == "" && err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case expected != "" && err == nil:
+		t.Fatalf("expected error %q, got nil", expected)
+	case expected != "" && !strings.Contains(err.Error(), expected):
+		t.Fatalf("expected error %q, got %v", expected, err)
+	}
+}
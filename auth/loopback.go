@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// AuthorizationCodeGrantType is a grant type of loopback code exchange
+// requests.
+const AuthorizationCodeGrantType = "authorization_code"
+
+// codeChallengeLen is a length of base64 encoded SHA-256 hash.
+const codeChallengeLen = 43
+
+// loopbackKeyPrefix is a prefix of loopback store keys.
+const loopbackKeyPrefix = "loopback/"
+
+var errLoopbackNotAllowed = errors.New("redirect_uri must be a loopback http URL")
+
+// LoopbackConfig contains parameters of loopback redirect login.
+type LoopbackConfig struct {
+	// CodeTTL is a time given to a client to exchange code.
+	CodeTTL time.Duration
+	// Store keeps codes not exchanged yet.
+	Store Store
+}
+
+// loopbackCode is an issued token waiting for exchange.
+type loopbackCode struct {
+	Token         *tokenResponse `json:"token"`
+	RedirectURI   string         `json:"redirect_uri"`
+	CodeChallenge string         `json:"code_challenge"`
+}
+
+// loopbackStore keeps one-time codes of tokens issued for loopback clients.
+type loopbackStore struct {
+	config LoopbackConfig
+}
+
+func newLoopbackStore(config LoopbackConfig) *loopbackStore {
+	if config.Store == nil {
+		config.Store = NewMemoryStore(defaultStoreCapacity)
+	}
+	return &loopbackStore{config: config}
+}
+
+// add saves the token issued for the login and returns one-time code for it.
+func (s *loopbackStore) add(login *LoginState, token *issuedToken) (string, error) {
+	data, err := json.Marshal(&loopbackCode{
+		Token:         newTokenResponse(token),
+		RedirectURI:   login.RedirectURI,
+		CodeChallenge: login.CodeChallenge,
+	})
+	if err != nil {
+		return "", err
+	}
+	code := randomString() + randomString()
+	if err = s.config.Store.Put(loopbackKeyPrefix+code, data, s.config.CodeTTL); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// take returns the token saved for the code and invalidates the code.
+func (s *loopbackStore) take(code, verifier, redirectURI string) (*tokenResponse, error) {
+	if code == "" || redirectURI == "" {
+		return nil, errors.New("invalid code")
+	}
+	data, err := s.config.Store.Take(loopbackKeyPrefix + code)
+	if err != nil {
+		return nil, errors.New("invalid or expired code")
+	}
+	entry := new(loopbackCode)
+	if err = json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+
+	if redirectURI != entry.RedirectURI {
+		return nil, errors.New("redirect_uri doesn't match")
+	}
+	challenge := oauth2.S256ChallengeFromVerifier(verifier)
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(entry.CodeChallenge)) != 1 {
+		return nil, errors.New("invalid code_verifier")
+	}
+	return entry.Token, nil
+}
+
+// setLoopback saves loopback redirect URI along with PKCE code challenge and
+// client state.
+func setLoopback(login *LoginState, query url.Values) error {
+	redirectURI, err := checkLoopbackURI(query.Get("redirect_uri"))
+	if err != nil {
+		return err
+	}
+	if method := query.Get("code_challenge_method"); method != "S256" {
+		return errors.New("code_challenge_method must be S256")
+	}
+	challenge := query.Get("code_challenge")
+	if len(challenge) != codeChallengeLen {
+		return errors.New("invalid code_challenge")
+	}
+
+	login.RedirectURI = redirectURI
+	login.CodeChallenge = challenge
+	login.ClientState = query.Get("state")
+	return nil
+}
+
+// checkLoopbackURI checks that URI points to loopback interface, any port
+// can be used.
+func checkLoopbackURI(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "http" || u.User != nil || u.Fragment != "" {
+		return "", errLoopbackNotAllowed
+	}
+	ip := net.ParseIP(u.Hostname())
+	if ip == nil || !ip.IsLoopback() {
+		return "", errLoopbackNotAllowed
+	}
+	return u.String(), nil
+}
+
+// completeLoopback redirects user to the loopback client with one-time code
+// or error.
+func (u *Authenticator) completeLoopback(w http.ResponseWriter, r *http.Request, login *LoginState, token *issuedToken, lErr *loginError) {
+	params := url.Values{}
+	if login.ClientState != "" {
+		params.Set("state", login.ClientState)
+	}
+	if lErr == nil {
+		code, err := u.loopback.add(login, token)
+		if err != nil {
+			u.log.Error("couldn't save loopback code", zap.Error(err))
+			lErr = newLoginError(http.StatusServiceUnavailable, errCodeServerError, err.Error(), err)
+		} else {
+			params.Set("code", code)
+		}
+	}
+	if lErr != nil {
+		params.Set("error", lErr.code)
+		params.Set("error_description", lErr.message)
+	}
+
+	redirectURI, _ := url.Parse(login.RedirectURI)
+	query := redirectURI.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	redirectURI.RawQuery = query.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// Token is a loopback code exchange handler.
+func (u *Authenticator) Token(w http.ResponseWriter, r *http.Request) {
+	if !u.requirePost(w, r) {
+		return
+	}
+	if grantType := r.PostFormValue("grant_type"); grantType != AuthorizationCodeGrantType {
+		u.writeJSON(w, http.StatusBadRequest, &errorResponse{
+			Error:       errCodeUnsupportedGrantType,
+			Description: "grant_type must be " + AuthorizationCodeGrantType,
+		})
+		return
+	}
+
+	// Invalid URI never matches the saved one.
+	redirectURI, _ := checkLoopbackURI(r.PostFormValue("redirect_uri"))
+	token, err := u.loopback.take(r.PostFormValue("code"), r.PostFormValue("code_verifier"), redirectURI)
+	if err != nil {
+		u.log.Info("loopback code exchange failed", zap.Error(err))
+		u.writeJSON(w, http.StatusBadRequest, &errorResponse{Error: errCodeInvalidGrant, Description: err.Error()})
+		return
+	}
+	u.writeJSON(w, http.StatusOK, token)
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+const testLoopbackURI = "http://127.0.0.1:5555/callback"
+
+// loopbackLogIn logs in for the loopback client and returns the code passed
+// to it.
+func loopbackLogIn(t *testing.T, a *Authenticator, verifier string) string {
+	t.Helper()
+	w := logIn(t, a, url.Values{
+		"redirect_uri":          {testLoopbackURI},
+		"code_challenge":        {oauth2.S256ChallengeFromVerifier(verifier)},
+		"code_challenge_method": {"S256"},
+		"state":                 {"client-state"},
+	}, nil)
+	if w.Code != http.StatusFound {
+		t.Fatalf("unexpected callback status %d: %s", w.Code, w.Body)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := location.Query()
+	location.RawQuery = ""
+	if location.String() != testLoopbackURI || query.Get("state") != "client-state" || query.Get("code") == "" {
+		t.Fatalf("unexpected loopback redirect %s", w.Header().Get("Location"))
+	}
+	return query.Get("code")
+}
+
+func exchangeCode(a *Authenticator, code, verifier, redirectURI string) *httptest.ResponseRecorder {
+	return postForm(a.Token, url.Values{
+		"grant_type":    {AuthorizationCodeGrantType},
+		"code":          {code},
+		"code_verifier": {verifier},
+		"redirect_uri":  {redirectURI},
+	})
+}
+
+func TestLoopbackFlow(t *testing.T) {
+	a := newTestAuthenticator(t, newTestIdP(t), nil)
+	verifier := oauth2.GenerateVerifier()
+	code := loopbackLogIn(t, a, verifier)
+
+	var token tokenResponse
+	decodeResponse(t, exchangeCode(a, code, verifier, testLoopbackURI), http.StatusOK, &token)
+	if token.Bearer == "" || token.TokenType != TokenBearer {
+		t.Fatalf("unexpected token %+v", token)
+	}
+
+	checkErrorResponse(t, exchangeCode(a, code, verifier, testLoopbackURI), http.StatusBadRequest, errCodeInvalidGrant)
+}
+
+func TestLoopbackInvalidExchange(t *testing.T) {
+	a := newTestAuthenticator(t, newTestIdP(t), nil)
+	verifier := oauth2.GenerateVerifier()
+
+	for _, tc := range []struct {
+		name        string
+		verifier    string
+		redirectURI string
+	}{
+		{name: "another verifier", verifier: oauth2.GenerateVerifier(), redirectURI: testLoopbackURI},
+		{name: "no verifier", redirectURI: testLoopbackURI},
+		{name: "another redirect uri", verifier: verifier, redirectURI: "http://127.0.0.1:5556/callback"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			code := loopbackLogIn(t, a, verifier)
+			checkErrorResponse(t, exchangeCode(a, code, tc.verifier, tc.redirectURI), http.StatusBadRequest, errCodeInvalidGrant)
+			// Code is invalidated by failed exchange too.
+			checkErrorResponse(t, exchangeCode(a, code, verifier, testLoopbackURI), http.StatusBadRequest, errCodeInvalidGrant)
+		})
+	}
+}
+
+func TestLoopbackRedirectURI(t *testing.T) {
+	a := newTestAuthenticator(t, newTestIdP(t), nil)
+	challenge := oauth2.S256ChallengeFromVerifier(oauth2.GenerateVerifier())
+
+	for _, uri := range []string{
+		"https://127.0.0.1:5555/callback",
+		"http://example.com/callback",
+		"http://localhost.example.com/callback",
+		"http://user@127.0.0.1/callback",
+	} {
+		t.Run(uri, func(t *testing.T) {
+			query := url.Values{
+				"service":               {testService},
+				"redirect_uri":          {uri},
+				"code_challenge":        {challenge},
+				"code_challenge_method": {"S256"},
+			}
+			w := httptest.NewRecorder()
+			a.LogInWith(w, httptest.NewRequest(http.MethodGet, "/login?"+query.Encode(), nil))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected %s to be rejected, got %d", uri, w.Code)
+			}
+		})
+	}
+}
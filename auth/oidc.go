@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+	oidcScope         = "openid"
+	oidcEmailScope    = "email"
+	oidcProfileScope  = "profile"
+
+	// tenantPlaceholder is used in issuers of multi-tenant providers
+	// (Microsoft Entra ID) instead of the actual tenant ID, such issuers
+	// aren't supported.
+	tenantPlaceholder = "{tenantid}"
+)
+
+// oidcProvider is a subset of OpenID Connect provider metadata.
+type oidcProvider struct {
+	Issuer      string `json:"issuer"`
+	AuthURL     string `json:"authorization_endpoint"`
+	TokenURL    string `json:"token_endpoint"`
+	UserInfoURL string `json:"userinfo_endpoint"`
+	JWKSURL     string `json:"jwks_uri"`
+}
+
+// discoverOIDC fetches OpenID Connect provider metadata of the issuer. Unless
+// exactIssuer is set, provider can report issuer different from the requested
+// one (Microsoft Entra ID uses tenant aliases).
+func discoverOIDC(ctx context.Context, issuer string, exactIssuer bool) (*oidcProvider, error) {
+	if issuer == "" {
+		return nil, fmt.Errorf("oidc issuer is not set")
+	}
+
+	url := strings.TrimSuffix(issuer, "/") + oidcDiscoveryPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting oidc discovery document: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed getting oidc discovery document: unexpected status %s", response.Status)
+	}
+
+	provider := new(oidcProvider)
+	if err = json.NewDecoder(response.Body).Decode(provider); err != nil {
+		return nil, fmt.Errorf("failed decoding oidc discovery document: %w", err)
+	}
+
+	if exactIssuer && strings.TrimSuffix(provider.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return nil, fmt.Errorf("oidc issuer mismatch: expected %s, got %s", issuer, provider.Issuer)
+	}
+	if provider.AuthURL == "" || provider.TokenURL == "" || provider.JWKSURL == "" {
+		return nil, fmt.Errorf("oidc discovery document of %s misses required endpoints", issuer)
+	}
+
+	return provider, nil
+}
+
+// fillConfig sets endpoints and scopes not provided explicitly in the config.
+// Default scopes include profile one if profile is set.
+func (p *oidcProvider) fillConfig(oauth *oauth2.Config, profile bool) {
+	if oauth.Endpoint.AuthURL == "" {
+		oauth.Endpoint.AuthURL = p.AuthURL
+	}
+	if oauth.Endpoint.TokenURL == "" {
+		oauth.Endpoint.TokenURL = p.TokenURL
+	}
+	if len(oauth.Scopes) == 0 {
+		oauth.Scopes = []string{oidcScope, oidcEmailScope}
+		if profile {
+			oauth.Scopes = append(oauth.Scopes, oidcProfileScope)
+		}
+	} else if !slices.Contains(oauth.Scopes, oidcScope) {
+		oauth.Scopes = append([]string{oidcScope}, oauth.Scopes...)
+	}
+}
+
+// idTokenLeeway is an allowed clock skew between the service and the issuer.
+const idTokenLeeway = time.Minute
+
+// idTokenVerifier checks ID tokens issued by OpenID Connect provider.
+type idTokenVerifier struct {
+	issuer   string
+	clientID string
+	keys     *keySet
+	// domainVerified makes email accepted without email_verified claim if
+	// xms_edov claim is true, for single-tenant providers not issuing the
+	// former.
+	domainVerified bool
+	// trustEmail makes email of domainVerified provider accepted without
+	// xms_edov claim too, it's still rejected if the claim is false.
+	trustEmail bool
+}
+
+// idTokenClaims is a subset of ID token claims used by the service.
+type idTokenClaims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	Expiry          int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce"`
+	Email           string   `json:"email"`
+	EmailVerified   flexBool `json:"email_verified"`
+	Name            string   `json:"name"`
+	Groups          []string `json:"groups"`
+	// EmailDomainVerified is Microsoft Entra ID claim showing that domain of
+	// the email is verified by the tenant.
+	EmailDomainVerified *flexBool `json:"xms_edov"`
+}
+
+// flexBool is a boolean claim which some providers (Apple) encode as string.
+type flexBool bool
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = s == "true"
+		return nil
+	}
+
+	var v bool
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*b = flexBool(v)
+	return nil
+}
+
+// audience is an "aud" claim which is either a string or an array of strings.
+type audience []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func newIDTokenVerifier(provider *oidcProvider, clientID string) *idTokenVerifier {
+	return &idTokenVerifier{
+		issuer:   provider.Issuer,
+		clientID: clientID,
+		keys:     newKeySet(provider.JWKSURL),
+	}
+}
+
+// verify checks ID token signature and claims. Only tokens with verified
+// email are accepted.
+func (v *idTokenVerifier) verify(ctx context.Context, raw, nonce string) (*idTokenClaims, error) {
+	token, err := parseJWT(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := v.keys.key(ctx, token.header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if err = token.verify(key); err != nil {
+		return nil, err
+	}
+
+	claims := new(idTokenClaims)
+	if err = json.Unmarshal(token.payload, claims); err != nil {
+		return nil, fmt.Errorf("malformed id token claims: %w", err)
+	}
+
+	trusted := v.domainVerified && v.trustEmail
+	if claims.EmailDomainVerified != nil {
+		trusted = v.domainVerified && bool(*claims.EmailDomainVerified)
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Issuer != v.issuer:
+		return nil, fmt.Errorf("id token issuer mismatch: %s", claims.Issuer)
+	case !slices.Contains(claims.Audience, v.clientID):
+		return nil, fmt.Errorf("id token is issued for another audience")
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != v.clientID:
+		return nil, fmt.Errorf("id token is issued for another party")
+	case now.After(time.Unix(claims.Expiry, 0).Add(idTokenLeeway)):
+		return nil, fmt.Errorf("id token is expired")
+	case now.Add(idTokenLeeway).Before(time.Unix(claims.IssuedAt, 0)):
+		return nil, fmt.Errorf("id token is issued in the future")
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("id token nonce mismatch")
+	case claims.Email == "" || !(bool(claims.EmailVerified) || trusted):
+		return nil, errUnverifiedEmail
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIDTokenVerify(t *testing.T) {
+	const (
+		issuer   = "https://issuer.example.com"
+		clientID = "client"
+		nonce    = "nonce"
+	)
+	server := newJWKSServer(t, rsaJWK("rsa", &testKeys.rsa.PublicKey))
+	verifier := newIDTokenVerifier(&oidcProvider{Issuer: issuer, JWKSURL: server.URL}, clientID)
+	edov := newIDTokenVerifier(&oidcProvider{Issuer: issuer, JWKSURL: server.URL}, clientID)
+	edov.domainVerified = true
+	trusting := newIDTokenVerifier(&oidcProvider{Issuer: issuer, JWKSURL: server.URL}, clientID)
+	trusting.domainVerified = true
+	trusting.trustEmail = true
+
+	now := time.Now()
+	valid := func() map[string]any {
+		return map[string]any{
+			"iss":            issuer,
+			"sub":            "user",
+			"aud":            clientID,
+			"exp":            now.Add(time.Hour).Unix(),
+			"iat":            now.Unix(),
+			"nonce":          nonce,
+			"email":          "user@example.com",
+			"email_verified": true,
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		claims   func(map[string]any)
+		verifier *idTokenVerifier
+		err      string
+	}{
+		{name: "valid"},
+		{name: "issuer mismatch", claims: func(c map[string]any) { c["iss"] = issuer + "/" }, err: "issuer mismatch"},
+		{name: "another audience", claims: func(c map[string]any) { c["aud"] = "other" }, err: "another audience"},
+		{name: "audience list", claims: func(c map[string]any) { c["aud"] = []string{"other", clientID}; c["azp"] = clientID }},
+		{name: "audience list without azp", claims: func(c map[string]any) { c["aud"] = []string{"other", clientID} }, err: "another party"},
+		{name: "audience list with another azp", claims: func(c map[string]any) { c["aud"] = []string{"other", clientID}; c["azp"] = "other" }, err: "another party"},
+		{name: "expired within leeway", claims: func(c map[string]any) { c["exp"] = now.Add(-idTokenLeeway / 2).Unix() }},
+		{name: "expired", claims: func(c map[string]any) { c["exp"] = now.Add(-2 * idTokenLeeway).Unix() }, err: "expired"},
+		{name: "issued in future within leeway", claims: func(c map[string]any) { c["iat"] = now.Add(idTokenLeeway / 2).Unix() }},
+		{name: "issued in future", claims: func(c map[string]any) { c["iat"] = now.Add(2 * idTokenLeeway).Unix() }, err: "in the future"},
+		{name: "nonce mismatch", claims: func(c map[string]any) { c["nonce"] = "other" }, err: "nonce mismatch"},
+		{name: "no nonce", claims: func(c map[string]any) { delete(c, "nonce") }, err: "nonce mismatch"},
+		{name: "string email_verified", claims: func(c map[string]any) { c["email_verified"] = "true" }},
+		{name: "unverified email", claims: func(c map[string]any) { c["email_verified"] = false }, err: errUnverifiedEmail.Error()},
+		{name: "no email", claims: func(c map[string]any) { delete(c, "email") }, err: errUnverifiedEmail.Error()},
+		{name: "verified domain without edov", claims: func(c map[string]any) { delete(c, "email_verified"); c["xms_edov"] = true }, err: errUnverifiedEmail.Error()},
+		{name: "verified domain", claims: func(c map[string]any) { delete(c, "email_verified"); c["xms_edov"] = true }, verifier: edov},
+		{name: "string verified domain", claims: func(c map[string]any) { delete(c, "email_verified"); c["xms_edov"] = "true" }, verifier: edov},
+		{name: "unverified domain", claims: func(c map[string]any) { delete(c, "email_verified"); c["xms_edov"] = false }, verifier: edov, err: errUnverifiedEmail.Error()},
+		{name: "no domain claim", claims: func(c map[string]any) { delete(c, "email_verified") }, verifier: edov, err: errUnverifiedEmail.Error()},
+		{name: "trusted email", claims: func(c map[string]any) { delete(c, "email_verified") }, verifier: trusting},
+		{name: "trusted email of verified domain", claims: func(c map[string]any) { delete(c, "email_verified"); c["xms_edov"] = true }, verifier: trusting},
+		{name: "trusted email of unverified domain", claims: func(c map[string]any) { delete(c, "email_verified"); c["xms_edov"] = false }, verifier: trusting, err: errUnverifiedEmail.Error()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := valid()
+			if tc.claims != nil {
+				tc.claims(claims)
+			}
+			v := verifier
+			if tc.verifier != nil {
+				v = tc.verifier
+			}
+			res, err := v.verify(context.Background(), signJWT(t, "RS256", "rsa", testKeys.rsa, claims), nonce)
+			checkErr(t, err, tc.err)
+			if err == nil && (res.Subject != "user" || res.Email != "user@example.com") {
+				t.Fatalf("unexpected claims %+v", res)
+			}
+		})
+	}
+
+	t.Run("unknown key", func(t *testing.T) {
+		_, err := verifier.verify(context.Background(), signJWT(t, "ES256", "p256", testKeys.p256, valid()), nonce)
+		checkErr(t, err, "unknown jwk")
+	})
+}
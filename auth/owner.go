@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/nspcc-dev/neo-go/pkg/crypto/keys"
+	"github.com/nspcc-dev/neofs-sdk-go/user"
+)
+
+// Modes of binding issued tokens to keys of users.
+const (
+	// UserBindingDisabled makes tokens issued for bearer config user only.
+	UserBindingDisabled = "disabled"
+	// UserBindingOptional makes tokens bound to user key if it's provided.
+	UserBindingOptional = "optional"
+	// UserBindingRequired makes login fail without user key.
+	UserBindingRequired = "required"
+)
+
+var errNoUserKey = errors.New("public_key or user_id parameter is required")
+
+func checkUserBinding(mode string) error {
+	switch mode {
+	case "", UserBindingDisabled, UserBindingOptional, UserBindingRequired:
+		return nil
+	default:
+		return fmt.Errorf("unsupported user binding mode '%s'", mode)
+	}
+}
+
+// setUserKey saves NeoFS user the token is requested for either by hex
+// encoded compressed public key or by user ID. Token owner is saved only if
+// binding is enabled, public key is saved anyway to be used in session tokens.
+func (u *Authenticator) setUserKey(login *LoginState, query url.Values) error {
+	var id user.ID
+	switch publicKey, userID := query.Get("public_key"), query.Get("user_id"); {
+	case publicKey != "" && userID != "":
+		return errors.New("public_key and user_id parameters can't be used together")
+	case publicKey != "":
+		key, err := keys.NewPublicKeyFromString(publicKey)
+		if err != nil {
+			return fmt.Errorf("invalid public key: %w", err)
+		}
+		login.PublicKey = hex.EncodeToString(key.Bytes())
+		id = user.NewFromECDSAPublicKey(ecdsa.PublicKey(*key))
+	case userID != "":
+		if err := id.DecodeString(userID); err != nil {
+			return fmt.Errorf("invalid user id: %w", err)
+		}
+	}
+
+	switch u.config.UserBinding {
+	case "", UserBindingDisabled:
+		return nil
+	case UserBindingRequired:
+		if id.IsZero() {
+			return errNoUserKey
+		}
+	}
+	if !id.IsZero() {
+		login.Owner = id.EncodeToString()
+	}
+	return nil
+}
+
+// userKey returns public key saved by setUserKey.
+func userKey(login *LoginState) (*ecdsa.PublicKey, error) {
+	if login.PublicKey == "" {
+		return nil, nil
+	}
+	key, err := keys.NewPublicKeyFromString(login.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return (*ecdsa.PublicKey)(key), nil
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/nspcc-dev/neofs-oauthz/bearer"
+	cid "github.com/nspcc-dev/neofs-sdk-go/container/id"
+)
+
+// Policy overrides parameters of tokens issued to matching users. User
+// matches the policy if it matches every non-empty list of conditions.
+type Policy struct {
+	// Providers are names of oauth services user logged in with.
+	Providers []string
+	// Emails are exact user emails, case-insensitive.
+	Emails []string
+	// Domains are domains of user emails including subdomains, matched the
+	// same way as access list entries.
+	Domains []string
+	// Groups are values of "groups" claim, user must be a member of any.
+	Groups []string
+	// Containers are names of containers matching users can request tokens
+	// for, any configured container can be requested if nil.
+	Containers []string
+	// TokenKinds are kinds of tokens matching users can request, the first
+	// one is issued by default. Config.TokenKinds are used if empty.
+	TokenKinds []string
+	// Bearer is a config of tokens issued to matching users.
+	Bearer *bearer.Config
+}
+
+type policy struct {
+	Policy
+	issuer *issuer
+}
+
+func newPolicies(policies []Policy, containers map[string]cid.ID, kinds []string) ([]policy, error) {
+	res := make([]policy, 0, len(policies))
+	for i, p := range policies {
+		if len(p.Providers)+len(p.Emails)+len(p.Domains)+len(p.Groups) == 0 {
+			return nil, fmt.Errorf("policy %d: no match conditions", i)
+		}
+		for _, name := range p.Containers {
+			if _, ok := containers[name]; !ok {
+				return nil, fmt.Errorf("policy %d: unknown container '%s'", i, name)
+			}
+		}
+		policyKinds := p.TokenKinds
+		if len(policyKinds) == 0 {
+			policyKinds = kinds
+		}
+		issuer, err := newIssuer(p.Bearer, policyKinds)
+		if err != nil {
+			return nil, fmt.Errorf("policy %d: %w", i, err)
+		}
+		domains := make([]string, 0, len(p.Domains))
+		for _, domain := range p.Domains {
+			entry := normalizeEntry(domain)
+			if entry == "" || strings.Contains(entry, "@") {
+				return nil, fmt.Errorf("policy %d: invalid domain '%s'", i, domain)
+			}
+			domains = append(domains, entry)
+		}
+		p.Domains = domains
+		res = append(res, policy{Policy: p, issuer: issuer})
+	}
+	return res, nil
+}
+
+func (p *Policy) matches(user *Identity) bool {
+	domain := emailDomain(strings.ToLower(user.Email))
+
+	return matchAny(p.Providers, user.Provider) &&
+		matchAny(p.Emails, user.Email) &&
+		(len(p.Domains) == 0 || slices.ContainsFunc(p.Domains, func(entry string) bool {
+			return matchDomain(entry, domain)
+		})) &&
+		(len(p.Groups) == 0 || slices.ContainsFunc(user.Groups, func(group string) bool {
+			return slices.Contains(p.Groups, group)
+		}))
+}
+
+// matchAny checks that the value is in the list ignoring case, empty list
+// matches any value.
+func matchAny(list []string, value string) bool {
+	return len(list) == 0 || slices.ContainsFunc(list, func(s string) bool {
+		return strings.EqualFold(s, value)
+	})
+}
+
+var errContainerNotAllowed = errors.New("container is not allowed")
+
+// tokenParams returns token issuer of the first policy user matches (or the
+// default one) and ID of the requested container. Zero ID is returned if no
+// container is requested.
+func (u *Authenticator) tokenParams(user *Identity, container string) (*issuer, cid.ID, error) {
+	issuer := u.issuer
+	for i := range u.policies {
+		p := &u.policies[i]
+		if !p.matches(user) {
+			continue
+		}
+		if container != "" && p.Containers != nil && !slices.Contains(p.Containers, container) {
+			return nil, cid.ID{}, errContainerNotAllowed
+		}
+		issuer = p.issuer
+		break
+	}
+	if container == "" {
+		return issuer, cid.ID{}, nil
+	}
+
+	containerID, ok := u.config.Containers[container]
+	if !ok {
+		return nil, cid.ID{}, errContainerNotAllowed
+	}
+	return issuer, containerID, nil
+}
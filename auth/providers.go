@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	googleEmailScope   = "https://www.googleapis.com/auth/userinfo.email"
+	googleProfileScope = "https://www.googleapis.com/auth/userinfo.profile"
+	githubEmailScope   = "user:email"
+
+	gitlabBaseURL = "https://gitlab.com"
+
+	entraIssuerFmt    = "https://login.microsoftonline.com/%s/v2.0"
+	entraOfflineScope = "offline_access"
+
+	appleIssuer = "https://appleid.apple.com"
+	// appleSecretLifetime is a lifetime of generated client secrets, Apple
+	// allows up to 6 months.
+	appleSecretLifetime = time.Hour
+)
+
+// AppleParams are credentials used to generate Sign in with Apple client secret.
+type AppleParams struct {
+	TeamID string
+	KeyID  string
+	// KeyPath is a path to .p8 private key file.
+	KeyPath string
+}
+
+// setDefaults sets endpoint and scopes not provided explicitly in the config.
+func setDefaults(oauth *oauth2.Config, endpoint oauth2.Endpoint, scopes ...string) {
+	if oauth.Endpoint.AuthURL == "" {
+		oauth.Endpoint.AuthURL = endpoint.AuthURL
+	}
+	if oauth.Endpoint.TokenURL == "" {
+		oauth.Endpoint.TokenURL = endpoint.TokenURL
+	}
+	if oauth.Endpoint.AuthStyle == oauth2.AuthStyleAutoDetect {
+		oauth.Endpoint.AuthStyle = endpoint.AuthStyle
+	}
+	if len(oauth.Scopes) == 0 {
+		oauth.Scopes = scopes
+	}
+}
+
+// entraMultiTenants are Microsoft Entra ID tenant aliases accepting users of
+// any tenant. Administrators of any tenant control email claims of its users,
+// so such aliases aren't supported.
+var entraMultiTenants = []string{"common", "organizations", "consumers"}
+
+// checkEntraTenant checks that tenant is a single tenant ID or domain.
+func checkEntraTenant(tenant string) error {
+	if tenant == "" {
+		return fmt.Errorf("entra tenant is not set")
+	}
+	if slices.Contains(entraMultiTenants, strings.ToLower(tenant)) {
+		return fmt.Errorf("multi-tenant entra tenant '%s' is not supported, set tenant ID", tenant)
+	}
+	return nil
+}
+
+// newOIDCVerifier discovers OpenID Connect provider and configures oauth to use it.
+func newOIDCVerifier(ctx context.Context, issuer string, exactIssuer bool, oauth *oauth2.Config, profile bool) (*idTokenVerifier, error) {
+	provider, err := discoverOIDC(ctx, issuer, exactIssuer)
+	if err != nil {
+		return nil, err
+	}
+	provider.fillConfig(oauth, profile)
+	return newIDTokenVerifier(provider, oauth.ClientID), nil
+}
+
+// newAppleSecret returns a function generating client secret JWT signed with
+// Apple private key.
+func newAppleSecret(params AppleParams, clientID string) (func() (string, error), error) {
+	if params.TeamID == "" || params.KeyID == "" {
+		return nil, fmt.Errorf("apple team id and key id must be set")
+	}
+
+	data, err := os.ReadFile(params.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading apple private key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("apple private key is not in PEM format")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing apple private key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("apple private key is %T, ECDSA expected", parsed)
+	}
+	if key.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("apple private key is on %s curve, P-256 expected", key.Curve.Params().Name)
+	}
+
+	header, err := json.Marshal(jwtHeader{Algorithm: "ES256", KeyID: params.KeyID})
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (string, error) {
+		now := time.Now()
+		claims, err := json.Marshal(map[string]any{
+			"iss": params.TeamID,
+			"iat": now.Unix(),
+			"exp": now.Add(appleSecretLifetime).Unix(),
+			"aud": appleIssuer,
+			"sub": clientID,
+		})
+		if err != nil {
+			return "", err
+		}
+		return signES256(key, header, claims)
+	}, nil
+}
+
+func signES256(key *ecdsa.PrivateKey, header, claims []byte) (string, error) {
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeKey saves the key to PKCS #8 PEM file.
+func writeKey(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.p8")
+	if err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAppleSecret(t *testing.T) {
+	secret, err := newAppleSecret(AppleParams{TeamID: "team", KeyID: "key", KeyPath: writeKey(t, testKeys.p256)}, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := secret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := parseJWT(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.header.Algorithm != "ES256" || token.header.KeyID != "key" {
+		t.Fatalf("unexpected header %+v", token.header)
+	}
+	if err = token.verify(&testKeys.p256.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]any
+	if err = json.Unmarshal(token.payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims["iss"] != "team" || claims["sub"] != "client" || claims["aud"] != appleIssuer {
+		t.Fatalf("unexpected claims %v", claims)
+	}
+}
+
+func TestNewAppleSecret(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		params AppleParams
+		err    string
+	}{
+		{name: "no team id", params: AppleParams{KeyID: "key", KeyPath: writeKey(t, testKeys.p256)}, err: "must be set"},
+		{name: "P-384 key", params: AppleParams{TeamID: "team", KeyID: "key", KeyPath: writeKey(t, testKeys.p384)}, err: "P-256 expected"},
+		{name: "rsa key", params: AppleParams{TeamID: "team", KeyID: "key", KeyPath: writeKey(t, testKeys.rsa)}, err: "ECDSA expected"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newAppleSecret(tc.params, "client")
+			checkErr(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+var errRedirectNotAllowed = errors.New("return URL is not allowed")
+
+// redirectAllowList validates return URLs requested by clients to prevent
+// open redirects.
+type redirectAllowList struct {
+	base    *url.URL
+	allowed []*url.URL
+}
+
+// newRedirectAllowList creates allow list of origins and path prefixes.
+// Relative entries and return URLs are resolved against the base URL, they're
+// paths of the same origin if the base URL has no host.
+func newRedirectAllowList(base string, allowed []string) (*redirectAllowList, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect url: %w", err)
+	}
+
+	l := &redirectAllowList{base: baseURL}
+	for _, entry := range allowed {
+		u, err := l.resolve(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed redirect '%s': %w", entry, err)
+		}
+		l.allowed = append(l.allowed, u)
+	}
+
+	return l, nil
+}
+
+// check returns absolute return URL if it's allowed.
+func (l *redirectAllowList) check(target string) (string, error) {
+	u, err := l.resolve(target)
+	if err != nil {
+		return "", errRedirectNotAllowed
+	}
+
+	for _, allowed := range l.allowed {
+		if u.Scheme == allowed.Scheme && u.Host == allowed.Host && hasPathPrefix(u.Path, allowed.Path) {
+			return u.String(), nil
+		}
+	}
+
+	return "", errRedirectNotAllowed
+}
+
+func (l *redirectAllowList) resolve(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	u = l.base.ResolveReference(u)
+
+	if u.User != nil {
+		return nil, fmt.Errorf("user info is not allowed")
+	}
+	switch {
+	case u.Scheme == "" && u.Host == "" && l.base.Host == "":
+		// Relative base URL makes relative entries same-origin paths.
+		if !strings.HasPrefix(u.Path, "/") {
+			return nil, fmt.Errorf("relative path '%s'", u.Path)
+		}
+	case u.Scheme != "http" && u.Scheme != "https":
+		return nil, fmt.Errorf("unsupported scheme '%s'", u.Scheme)
+	case u.Host == "":
+		return nil, fmt.Errorf("no host")
+	}
+
+	u.Host = strings.ToLower(u.Host)
+	if u.Path != "" {
+		cleaned := path.Clean(u.Path)
+		if strings.HasSuffix(u.Path, "/") && cleaned != "/" {
+			cleaned += "/"
+		}
+		u.Path, u.RawPath = cleaned, ""
+	}
+	return u, nil
+}
+
+// hasPathPrefix checks that p is the prefix path itself or lies under it.
+func hasPathPrefix(p, prefix string) bool {
+	if prefix == "" || prefix == "/" || p == prefix {
+		return true
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return strings.HasPrefix(p, prefix)
+}
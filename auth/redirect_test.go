@@ -0,0 +1,122 @@
+package auth
+
+import "testing"
+
+func TestRedirectAllowListCheck(t *testing.T) {
+	l, err := newRedirectAllowList("https://app.example.com/callback", []string{
+		"/send",
+		"https://other.example.com/app/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		target   string
+		expected string // empty if not allowed
+	}{
+		{target: "/send", expected: "https://app.example.com/send"},
+		{target: "/send/", expected: "https://app.example.com/send/"},
+		{target: "/send/file?x=1#top", expected: "https://app.example.com/send/file?x=1#top"},
+		{target: "send/file", expected: "https://app.example.com/send/file"},
+		{target: "https://app.example.com/send/file", expected: "https://app.example.com/send/file"},
+		{target: "HTTPS://APP.EXAMPLE.COM/send", expected: "https://app.example.com/send"},
+		{target: "https://other.example.com/app/page", expected: "https://other.example.com/app/page"},
+		{target: "/send/a/../b", expected: "https://app.example.com/send/b"},
+
+		// Other origins.
+		{target: "//evil.com"},
+		{target: "//evil.com/send"},
+		{target: "https://evil.com/send"},
+		{target: "https://app.example.com@evil.com/send"},
+		{target: "https://user@app.example.com/send"},
+		{target: "https://app.example.com.evil.com/send"},
+		{target: "https://app.example.com:8443/send"},
+		{target: "http://app.example.com/send"},
+		{target: "javascript:alert(1)"},
+		{target: "ftp://app.example.com/send"},
+		{target: "https:/send"},
+		{target: "https://other.example.com/app"},
+
+		// Paths escaping the prefix.
+		{target: "/sendx"},
+		{target: "/send-other"},
+		{target: "/"},
+		{target: "/SEND"},
+		{target: "/send/../admin"},
+		{target: "/send/%2e%2e/admin"},
+		{target: "/send/%2E%2E"},
+		{target: "/send/..%2fadmin"},
+		{target: "https://other.example.com/application"},
+		{target: "https://other.example.com/app/../admin"},
+	} {
+		t.Run(tc.target, func(t *testing.T) {
+			res, err := l.check(tc.target)
+			if tc.expected == "" {
+				if err == nil {
+					t.Fatalf("expected %q to be rejected, got %q", tc.target, res)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected %q to be allowed: %v", tc.target, err)
+			}
+			if res != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, res)
+			}
+		})
+	}
+}
+
+func TestRedirectAllowListRelativeBase(t *testing.T) {
+	l, err := newRedirectAllowList("/", []string{
+		"https://app.example.com",
+		"/send/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		target   string
+		expected string // empty if not allowed
+	}{
+		{target: "/send/", expected: "/send/"},
+		{target: "/send/file?x=1", expected: "/send/file?x=1"},
+		{target: "send/file", expected: "/send/file"},
+		{target: "https://app.example.com/any", expected: "https://app.example.com/any"},
+		{target: "/sendx"},
+		{target: "/send"},
+		{target: "/"},
+		{target: "/send/../admin"},
+		{target: "/send/%2e%2e/admin"},
+		{target: "//evil.com/send/"},
+		{target: "https://evil.com/send/"},
+		{target: "http://app.example.com/any"},
+		{target: "javascript:alert(1)"},
+	} {
+		t.Run(tc.target, func(t *testing.T) {
+			res, err := l.check(tc.target)
+			if tc.expected == "" {
+				if err == nil {
+					t.Fatalf("expected %q to be rejected, got %q", tc.target, res)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected %q to be allowed: %v", tc.target, err)
+			}
+			if res != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, res)
+			}
+		})
+	}
+}
+
+func TestNewRedirectAllowList(t *testing.T) {
+	for _, entry := range []string{"javascript:alert(1)", "https://user@app.example.com/", "https://", "%zz"} {
+		if _, err := newRedirectAllowList("https://app.example.com", []string{entry}); err == nil {
+			t.Fatalf("expected '%s' to be rejected", entry)
+		}
+	}
+}
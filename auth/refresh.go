@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+// refreshCookieName is a name of the cookie with refresh token.
+const refreshCookieName = "Refresh"
+
+var (
+	errSessionInvalid = errors.New("invalid refresh token")
+	errSessionExpired = errors.New("session is expired")
+	errSessionRevoked = errors.New("session is revoked")
+)
+
+// RefreshConfig contains parameters of token refresh.
+type RefreshConfig struct {
+	// Secret is used to seal refresh tokens, refresh is disabled if empty.
+	Secret string
+	// SessionLifetime is a time tokens can be refreshed for after login.
+	SessionLifetime time.Duration
+	// Store keeps IDs of valid refresh tokens.
+	Store Store
+}
+
+// refreshKeyPrefix is a prefix of refresh store keys.
+const refreshKeyPrefix = "refresh/"
+
+// refreshSession is a login session sealed into refresh token.
+type refreshSession struct {
+	// ID identifies refresh token, it changes on every refresh.
+	ID       string    `json:"id"`
+	Identity Identity  `json:"identity"`
+	Expires  time.Time `json:"expires"`
+	// Container, Owner, PublicKey and TokenKind are parameters of the
+	// requested token, see LoginState.
+	Container string `json:"container,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	PublicKey string `json:"public_key,omitempty"`
+	TokenKind string `json:"token_kind,omitempty"`
+	// RefreshToken is a refresh token of external service, the session is
+	// checked with the service on every refresh.
+	RefreshToken string `json:"refresh_token"`
+}
+
+// refresher seals login sessions into refresh tokens. Only refresh tokens
+// with IDs kept in the store are valid, every ID is removed on use, so
+// refresh tokens can't be reused and revoked sessions are just not saved
+// again.
+type refresher struct {
+	lifetime time.Duration
+	sealer   *sealer
+	store    Store
+}
+
+func newRefresher(config RefreshConfig) (*refresher, error) {
+	if config.Secret == "" {
+		return nil, nil
+	}
+	if len(config.Secret) < minStateSecretLen {
+		return nil, fmt.Errorf("refresh secret must be at least %d characters long", minStateSecretLen)
+	}
+	if config.SessionLifetime <= 0 {
+		return nil, fmt.Errorf("invalid session lifetime %s", config.SessionLifetime)
+	}
+	s, err := newSealer(config.Secret)
+	if err != nil {
+		return nil, err
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryStore(defaultStoreCapacity)
+	}
+	return &refresher{
+		lifetime: config.SessionLifetime,
+		sealer:   s,
+		store:    config.Store,
+	}, nil
+}
+
+// newSession creates session of the user logged in. Sessions can't be
+// checked with the service without its refresh token, so nil is returned if
+// there is none.
+func (r *refresher) newSession(login *LoginState, user *Identity, token *oauth2.Token) *refreshSession {
+	if token.RefreshToken == "" {
+		return nil
+	}
+	return &refreshSession{
+		Identity:     *user,
+		Expires:      time.Now().Add(r.lifetime),
+		Container:    login.Container,
+		Owner:        login.Owner,
+		PublicKey:    login.PublicKey,
+		TokenKind:    login.TokenKind,
+		RefreshToken: token.RefreshToken,
+	}
+}
+
+// seal saves the session under new ID and returns refresh token with it.
+func (r *refresher) seal(session *refreshSession) (string, error) {
+	session.ID = randomString()
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	if err = r.save(session); err != nil {
+		return "", err
+	}
+	return r.sealer.seal(data), nil
+}
+
+// open returns session sealed into refresh token if it's not expired.
+func (r *refresher) open(refreshToken string) (*refreshSession, error) {
+	data, err := r.sealer.open(refreshToken)
+	if err != nil {
+		return nil, errSessionInvalid
+	}
+	session := new(refreshSession)
+	if err = json.Unmarshal(data, session); err != nil || session.ID == "" || session.RefreshToken == "" {
+		return nil, errSessionInvalid
+	}
+	if time.Now().After(session.Expires) {
+		return nil, errSessionExpired
+	}
+	return session, nil
+}
+
+// use invalidates refresh token of the session, it fails if the token is
+// already used or revoked.
+func (r *refresher) use(session *refreshSession) error {
+	if _, err := r.store.Take(refreshKeyPrefix + session.ID); err != nil {
+		return errSessionRevoked
+	}
+	return nil
+}
+
+// save makes refresh token of the session valid.
+func (r *refresher) save(session *refreshSession) error {
+	return r.store.Put(refreshKeyPrefix+session.ID, []byte{}, time.Until(session.Expires))
+}
+
+// Refresh is a token refresh handler. Refresh token is taken from
+// refresh_token parameter or from the cookie set on login.
+func (u *Authenticator) Refresh(w http.ResponseWriter, r *http.Request) {
+	if !u.requirePost(w, r) {
+		return
+	}
+	if u.refresher == nil {
+		u.writeJSON(w, http.StatusNotFound, &errorResponse{
+			Error:       errCodeInvalidRequest,
+			Description: "token refresh is disabled",
+		})
+		return
+	}
+
+	refreshToken, fromCookie := r.PostFormValue("refresh_token"), false
+	if refreshToken == "" {
+		if cookie, err := r.Cookie(refreshCookieName); err == nil {
+			refreshToken, fromCookie = cookie.Value, true
+		}
+	}
+
+	session, err := u.refresher.open(refreshToken)
+	if err != nil {
+		u.log.Info("invalid refresh token", zap.Error(err))
+		u.writeError(w, newLoginError(http.StatusBadRequest, errCodeInvalidGrant, err.Error(), err))
+		return
+	}
+
+	token, lErr := u.refresh(r.Context(), session)
+	if lErr != nil {
+		u.writeError(w, lErr)
+		return
+	}
+
+	if fromCookie {
+		u.setTokenCookies(w, token)
+		// Refresh token isn't exposed to scripts if it's kept in HttpOnly
+		// cookie.
+		token.refreshToken = ""
+	}
+	u.writeJSON(w, http.StatusOK, newTokenResponse(token))
+}
+
+// refresh checks the session and issues new token for it. The session is
+// revoked if the service rejects its refresh token or the user isn't allowed
+// to get tokens anymore, it stays valid after temporary failures.
+func (u *Authenticator) refresh(ctx context.Context, session *refreshSession) (*issuedToken, *loginError) {
+	if err := u.refresher.use(session); err != nil {
+		return nil, newLoginError(http.StatusBadRequest, errCodeInvalidGrant, err.Error(), err)
+	}
+	restore := func() {
+		if err := u.refresher.save(session); err != nil {
+			u.log.Error("couldn't restore refresh session", zap.Error(err))
+		}
+	}
+
+	user := &session.Identity
+	oauth, ok := u.services.Oauth(user.Provider)
+	if !ok {
+		return nil, newLoginError(http.StatusBadRequest, errCodeInvalidGrant, errSessionRevoked.Error(), nil)
+	}
+	oauthToken, err := oauth.Refresh(ctx, session.RefreshToken)
+	if err != nil {
+		// Server errors of the service are temporary, only rejected
+		// refresh tokens revoke the session.
+		if retrieveErr := (*oauth2.RetrieveError)(nil); errors.As(err, &retrieveErr) &&
+			(retrieveErr.Response == nil || retrieveErr.Response.StatusCode < http.StatusInternalServerError) {
+			u.log.Info("session revoked by external service", zap.String("email", user.Email), zap.Error(err))
+			return nil, newLoginError(http.StatusBadRequest, errCodeInvalidGrant, errSessionRevoked.Error(), err)
+		}
+		u.log.Error("couldn't refresh session", zap.String("email", user.Email), zap.Error(err))
+		restore()
+		return nil, newLoginError(http.StatusServiceUnavailable, errCodeServerError, "external service is unavailable", err)
+	}
+	if oauthToken.RefreshToken != "" {
+		session.RefreshToken = oauthToken.RefreshToken
+	}
+
+	login := &LoginState{
+		Service:   user.Provider,
+		Container: session.Container,
+		Owner:     session.Owner,
+		PublicKey: session.PublicKey,
+		TokenKind: session.TokenKind,
+	}
+	token, lErr := u.issueToken(ctx, login, user)
+	if lErr != nil {
+		if lErr.code != errCodeAccessDenied {
+			restore()
+		}
+		return nil, lErr
+	}
+
+	if err = u.setRefreshToken(token, session); err != nil {
+		return nil, newLoginError(http.StatusInternalServerError, errCodeServerError, err.Error(), err)
+	}
+	return token, nil
+}
+
+// setRefreshToken seals the session into refresh token of the issued token.
+func (u *Authenticator) setRefreshToken(token *issuedToken, session *refreshSession) error {
+	refreshToken, err := u.refresher.seal(session)
+	if err != nil {
+		u.log.Error("couldn't seal refresh token", zap.Error(err))
+		return err
+	}
+	token.refreshToken = refreshToken
+	token.sessionExpires = session.Expires
+	return nil
+}
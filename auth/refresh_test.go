@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func newRefreshAuthenticator(t *testing.T, idp *testIdP) *Authenticator {
+	return newTestAuthenticator(t, idp, func(c *Config) {
+		c.Refresh = RefreshConfig{
+			Secret:          "refresh-secret-for-tests",
+			SessionLifetime: time.Hour,
+			Store:           NewMemoryStore(100),
+		}
+	})
+}
+
+func TestRefreshFlow(t *testing.T) {
+	idp := newTestIdP(t)
+	a := newRefreshAuthenticator(t, idp)
+
+	var token tokenResponse
+	decodeResponse(t, logIn(t, a, url.Values{}, http.Header{"Accept": {"application/json"}}), http.StatusOK, &token)
+	if token.Bearer == "" || token.RefreshToken == "" {
+		t.Fatalf("unexpected token %+v", token)
+	}
+
+	refresh := func(refreshToken string) *tokenResponse {
+		t.Helper()
+		res := new(tokenResponse)
+		decodeResponse(t, postForm(a.Refresh, url.Values{"refresh_token": {refreshToken}}), http.StatusOK, res)
+		if res.Bearer == "" || res.RefreshToken == "" || res.RefreshToken == refreshToken {
+			t.Fatalf("unexpected refreshed token %+v", res)
+		}
+		return res
+	}
+	refreshed := refresh(token.RefreshToken)
+
+	// Refresh tokens are rotated.
+	checkErrorResponse(t, postForm(a.Refresh, url.Values{"refresh_token": {token.RefreshToken}}), http.StatusBadRequest, errCodeInvalidGrant)
+
+	// Session survives temporary failures of the service.
+	idp.setRefreshStatus(http.StatusServiceUnavailable)
+	checkErrorResponse(t, postForm(a.Refresh, url.Values{"refresh_token": {refreshed.RefreshToken}}), http.StatusServiceUnavailable, errCodeServerError)
+	idp.setRefreshStatus(0)
+	refreshed = refresh(refreshed.RefreshToken)
+
+	// Session is revoked once the service rejects it.
+	idp.revoke()
+	checkErrorResponse(t, postForm(a.Refresh, url.Values{"refresh_token": {refreshed.RefreshToken}}), http.StatusBadRequest, errCodeInvalidGrant)
+	checkErrorResponse(t, postForm(a.Refresh, url.Values{"refresh_token": {refreshed.RefreshToken}}), http.StatusBadRequest, errCodeInvalidGrant)
+}
+
+func TestRefreshInvalidToken(t *testing.T) {
+	a := newRefreshAuthenticator(t, newTestIdP(t))
+
+	var token tokenResponse
+	decodeResponse(t, logIn(t, a, url.Values{}, http.Header{"Accept": {"application/json"}}), http.StatusOK, &token)
+
+	for _, refreshToken := range []string{"", "invalid", token.RefreshToken[:len(token.RefreshToken)-2]} {
+		checkErrorResponse(t, postForm(a.Refresh, url.Values{"refresh_token": {refreshToken}}), http.StatusBadRequest, errCodeInvalidGrant)
+	}
+
+	// Another secret can't open the token.
+	other := newTestAuthenticator(t, newTestIdP(t), func(c *Config) {
+		c.Refresh = RefreshConfig{Secret: "another-refresh-secret", SessionLifetime: time.Hour}
+	})
+	checkErrorResponse(t, postForm(other.Refresh, url.Values{"refresh_token": {token.RefreshToken}}), http.StatusBadRequest, errCodeInvalidGrant)
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+var errSealedData = errors.New("invalid sealed data")
+
+// sealer encrypts and authenticates data with AES-256-GCM, so it can be safely
+// handed to the client and returned back later.
+type sealer struct {
+	aead cipher.AEAD
+}
+
+func newSealer(secret string) (*sealer, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{aead: aead}, nil
+}
+
+// seal encrypts data and returns URL-safe encoded result.
+func (s *sealer) seal(data []byte) string {
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(data)+s.aead.Overhead())
+	_, _ = rand.Read(nonce)
+	return base64.RawURLEncoding.EncodeToString(s.aead.Seal(nonce, nonce, data, nil))
+}
+
+// open decrypts data sealed by seal.
+func (s *sealer) open(sealed string) ([]byte, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < s.aead.NonceSize() {
+		return nil, errSealedData
+	}
+	data, err := s.aead.Open(nil, raw[:s.aead.NonceSize()], raw[s.aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errSealedData
+	}
+	return data, nil
+}
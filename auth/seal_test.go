@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestSealer(t *testing.T) {
+	s, err := newSealer("sealer-secret-for-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := newSealer("another-sealer-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte(`{"service":"google"}`)
+	sealed := s.seal(data)
+	if sealed == s.seal(data) {
+		t.Fatal("sealing must be randomized")
+	}
+	opened, err := s.open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(opened) != string(data) {
+		t.Fatalf("expected %s, got %s", data, opened)
+	}
+
+	raw, _ := base64.RawURLEncoding.DecodeString(sealed)
+	tampered := func(i int) string {
+		b := append([]byte(nil), raw...)
+		b[i] ^= 1
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		sealed string
+		sealer *sealer
+	}{
+		{name: "tampered nonce", sealed: tampered(0)},
+		{name: "tampered data", sealed: tampered(len(raw) / 2)},
+		{name: "tampered tag", sealed: tampered(len(raw) - 1)},
+		{name: "truncated", sealed: base64.RawURLEncoding.EncodeToString(raw[:len(raw)-1])},
+		{name: "nonce only", sealed: base64.RawURLEncoding.EncodeToString(raw[:12])},
+		{name: "short", sealed: base64.RawURLEncoding.EncodeToString(raw[:4])},
+		{name: "empty"},
+		{name: "not base64", sealed: sealed + "!"},
+		{name: "padded", sealed: base64.URLEncoding.EncodeToString(raw) + "="},
+		{name: "another secret", sealed: sealed, sealer: other},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opener := s
+			if tc.sealer != nil {
+				opener = tc.sealer
+			}
+			if _, err := opener.open(tc.sealed); !errors.Is(err, errSealedData) {
+				t.Fatalf("expected %v, got %v", errSealedData, err)
+			}
+		})
+	}
+}
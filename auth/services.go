@@ -1,80 +1,238 @@
 package auth
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"sync"
+	"slices"
+	"strings"
+	"time"
 
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
 )
 
 // Services stores supported external oauth2 services.
 type Services struct {
 	services map[string]*ServiceOauth
-	states   *stateStorage
+	states   StateStorage
 }
 
-type stateStorage struct {
-	storage map[string]string
-	m       sync.Mutex
+// LoginState is data bound to oauth state until the callback is received.
+type LoginState struct {
+	Service string `json:"service"`
+	// Nonce binds OpenID Connect ID token to the login.
+	Nonce string `json:"nonce"`
+	// Verifier is a PKCE code verifier, empty if PKCE is disabled.
+	Verifier string `json:"verifier,omitempty"`
+	// ReturnTo is a URL to redirect user to after login.
+	ReturnTo string `json:"return_to,omitempty"`
+	// Container is a name of the container requested by user.
+	Container string `json:"container,omitempty"`
+	// Owner is an ID of NeoFS user the token is requested for.
+	Owner string `json:"owner,omitempty"`
+	// PublicKey is a hex encoded public key of the user.
+	PublicKey string `json:"public_key,omitempty"`
+	// TokenKind is a kind of the requested token, default one if empty.
+	TokenKind string `json:"token_kind,omitempty"`
+	// UserCode is a code of device authorization the login is made for.
+	UserCode string `json:"user_code,omitempty"`
+	// RedirectURI is a loopback URI of the client the token is delivered to.
+	RedirectURI string `json:"redirect_uri,omitempty"`
+	// CodeChallenge is a PKCE code challenge of the loopback client.
+	CodeChallenge string `json:"code_challenge,omitempty"`
+	// ClientState is a state of the loopback client passed back to it.
+	ClientState string `json:"client_state,omitempty"`
+	// Created is the time the state was saved to the storage at.
+	Created time.Time `json:"created"`
 }
 
 // ServiceOauth is config for specific service.
 type ServiceOauth struct {
-	name  string
-	oauth *oauth2.Config
-	fn    func(token string) (*http.Request, error)
+	name    string
+	oauth   *oauth2.Config
+	fn      func(token string) (*http.Request, error)
+	parse   userInfoParser
+	idToken *idTokenVerifier
+	pkce    bool
+	// formPost makes service send callback as POST request.
+	formPost bool
+	// clientSecret generates client secret for services requiring it to
+	// be signed, static secret from oauth config is used if nil.
+	clientSecret func() (string, error)
+	// profile requests user ID and name from services not providing them
+	// along with email, parseProfile fills the user with them.
+	profile      userInfoFn
+	parseProfile func(data []byte, user *Identity) error
+	// authOpts are additional service specific authorization parameters.
+	authOpts []oauth2.AuthCodeOption
 }
 
 type userInfoFn func(token string) (*http.Request, error)
 
+// userInfoParser extracts user identity with verified email from user info
+// response.
+type userInfoParser func(data []byte) (*Identity, error)
+
+// Identity is a user identity confirmed by external service.
+type Identity struct {
+	Email string
+	// Subject is a user ID in external service, can be empty if service
+	// doesn't provide it.
+	Subject string
+	// Provider is a name of the service user logged in with.
+	Provider string
+	// Name is a user display name, can be empty.
+	Name string
+	// Groups are groups user is a member of, taken from "groups" claim of
+	// OpenID Connect services or groups path of generic ones.
+	Groups []string
+}
+
+// errUnverifiedEmail is returned when service has no verified email of the user.
+var errUnverifiedEmail = errors.New("no verified email address")
+
+// Supported service types.
+const (
+	ServiceGoogle  = "google"
+	ServiceGithub  = "github"
+	ServiceOIDC    = "oidc"
+	ServiceGeneric = "generic"
+	ServiceGitlab  = "gitlab"
+	ServiceEntra   = "entra"
+	ServiceApple   = "apple"
+)
+
+// ServiceParams contains settings of external oauth2 service.
+type ServiceParams struct {
+	// Type is one of the supported service types.
+	Type string
+	// Issuer is an OpenID Connect issuer URL, used by ServiceOIDC only.
+	Issuer string
+	// BaseURL is an URL of self-hosted ServiceGitlab, gitlab.com if empty.
+	BaseURL string
+	// Tenant is a ServiceEntra tenant ID or domain, required.
+	Tenant string
+	// TrustUnverifiedDomain makes ServiceEntra accept email without xms_edov
+	// claim, email is rejected if the claim is false anyway.
+	TrustUnverifiedDomain bool
+	// Apple contains ServiceApple credentials.
+	Apple AppleParams
+	// PKCE enables S256 code challenge in authorization requests.
+	PKCE bool
+	// Profile adds scopes of user display name to the default ones.
+	Profile bool
+	// Offline requests refresh token from the service, it's used to check
+	// sessions on token refresh.
+	Offline bool
+	Oauth   *oauth2.Config
+	// UserInfo describes user info endpoint of ServiceGeneric.
+	UserInfo UserInfoParams
+}
+
 // NewServices creates services storage using config.
-func NewServices(configs map[string]*ServiceOauth) *Services {
+func NewServices(configs map[string]*ServiceOauth, states StateStorage) *Services {
 	return &Services{
 		services: configs,
-		states:   newStateStorage(),
+		states:   states,
 	}
 }
 
-func newStateStorage() *stateStorage {
-	return &stateStorage{storage: make(map[string]string)}
-}
-
 // NewServiceConfig creates config for supported services.
-func NewServiceConfig(name string, oauth *oauth2.Config) (*ServiceOauth, error) {
-	var fn userInfoFn
-	switch name {
-	case "google":
-		fn = googleRequest
-	case "github":
-		fn = githubRequest
+func NewServiceConfig(ctx context.Context, name string, params ServiceParams) (*ServiceOauth, error) {
+	var (
+		err          error
+		fn           userInfoFn
+		parse        userInfoParser
+		idToken      *idTokenVerifier
+		formPost     bool
+		clientSecret func() (string, error)
+		authOpts     []oauth2.AuthCodeOption
+		profile      userInfoFn
+		parseProfile func([]byte, *Identity) error
+		oauth        = params.Oauth
+	)
+	switch params.Type {
+	case ServiceGoogle:
+		fn, parse = googleRequest, googleUser
+		if params.Profile {
+			setDefaults(oauth, endpoints.Google, googleEmailScope, googleProfileScope)
+		} else {
+			setDefaults(oauth, endpoints.Google, googleEmailScope)
+		}
+		if params.Offline {
+			// Google issues refresh token on consent only.
+			authOpts = append(authOpts, oauth2.AccessTypeOffline, oauth2.ApprovalForce)
+		}
+	case ServiceGithub:
+		fn, parse = githubRequest, githubUser
+		profile, parseProfile = githubUserRequest, githubProfile
+		setDefaults(oauth, endpoints.GitHub, githubEmailScope)
+	case ServiceOIDC:
+		idToken, err = newOIDCVerifier(ctx, params.Issuer, true, oauth, params.Profile)
+	case ServiceGitlab:
+		idToken, err = newOIDCVerifier(ctx, cmp.Or(params.BaseURL, gitlabBaseURL), true, oauth, params.Profile)
+	case ServiceEntra:
+		setDefaults(oauth, oauth2.Endpoint{}, oidcScope, oidcEmailScope, oidcProfileScope)
+		if params.Offline && !slices.Contains(oauth.Scopes, entraOfflineScope) {
+			oauth.Scopes = append(oauth.Scopes, entraOfflineScope)
+		}
+		if err = checkEntraTenant(params.Tenant); err == nil {
+			idToken, err = newOIDCVerifier(ctx, fmt.Sprintf(entraIssuerFmt, params.Tenant), false, oauth, false)
+		}
+		if err == nil && strings.Contains(idToken.issuer, tenantPlaceholder) {
+			err = fmt.Errorf("multi-tenant issuer %s is not supported", idToken.issuer)
+		}
+		if err == nil {
+			// Entra ID doesn't issue email_verified claim, optional
+			// xms_edov one shows whether email domain is verified.
+			idToken.domainVerified = true
+			idToken.trustEmail = params.TrustUnverifiedDomain
+		}
+	case ServiceApple:
+		setDefaults(oauth, oauth2.Endpoint{AuthStyle: oauth2.AuthStyleInParams})
+		// Apple provides no name in ID token.
+		idToken, err = newOIDCVerifier(ctx, appleIssuer, true, oauth, false)
+		if err == nil {
+			clientSecret, err = newAppleSecret(params.Apple, oauth.ClientID)
+		}
+		formPost = true
+	case ServiceGeneric:
+		fn, parse, err = newGenericUserInfo(params.UserInfo)
 	default:
-		return nil, fmt.Errorf("unsupported service %s", name)
+		return nil, fmt.Errorf("unsupported service type '%s' for %s", params.Type, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
 	}
 
-	return &ServiceOauth{name, oauth, fn}, nil
+	return &ServiceOauth{
+		name:         name,
+		oauth:        oauth,
+		fn:           fn,
+		parse:        parse,
+		idToken:      idToken,
+		pkce:         params.PKCE,
+		formPost:     formPost,
+		clientSecret: clientSecret,
+		profile:      profile,
+		parseProfile: parseProfile,
+		authOpts:     authOpts,
+	}, nil
 }
 
-// AddState saves new state to auth into storage.
-func (s *Services) AddState(state, service string) {
-	s.states.m.Lock()
-	s.states.storage[state] = service
-	s.states.m.Unlock()
+// AddState saves new login into storage and returns state to auth with.
+func (s *Services) AddState(login *LoginState) (string, error) {
+	return s.states.Put(login)
 }
 
 // RemoveState gets and deletes used state from storage.
-func (s *Services) RemoveState(state string) (string, error) {
-	s.states.m.Lock()
-	defer s.states.m.Unlock()
-	service, ok := s.states.storage[state]
-	if !ok {
-		return "", fmt.Errorf("invalid oauth state")
-	}
-	delete(s.states.storage, state)
-	return service, nil
+func (s *Services) RemoveState(state string) (*LoginState, error) {
+	return s.states.Take(state)
 }
 
 // Oauth gets config for specified service.
@@ -83,45 +241,135 @@ func (s *Services) Oauth(service string) (*ServiceOauth, bool) {
 	return config, ok
 }
 
+// NewLogin creates state of a new login via the service.
+func (c *ServiceOauth) NewLogin() *LoginState {
+	login := &LoginState{
+		Service: c.name,
+		Nonce:   randomString(),
+	}
+	if c.pkce {
+		login.Verifier = oauth2.GenerateVerifier()
+	}
+	return login
+}
+
 // AuthCodeURL gets URL to auth on external service using state.
-func (c *ServiceOauth) AuthCodeURL(state string) string {
-	return c.oauth.AuthCodeURL(state)
+func (c *ServiceOauth) AuthCodeURL(state string, login *LoginState) string {
+	opts := slices.Clone(c.authOpts)
+	if c.idToken != nil {
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", login.Nonce))
+	}
+	if login.Verifier != "" {
+		opts = append(opts, oauth2.S256ChallengeOption(login.Verifier))
+	}
+	if c.formPost {
+		opts = append(opts, oauth2.SetAuthURLParam("response_mode", "form_post"))
+	}
+	return c.oauth.AuthCodeURL(state, opts...)
 }
 
 // Exchange gets auth token after authorization.
-func (c *ServiceOauth) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
-	return c.oauth.Exchange(ctx, code)
+func (c *ServiceOauth) Exchange(ctx context.Context, code string, login *LoginState) (*oauth2.Token, error) {
+	var opts []oauth2.AuthCodeOption
+	if login.Verifier != "" {
+		opts = append(opts, oauth2.VerifierOption(login.Verifier))
+	}
+
+	config, err := c.config()
+	if err != nil {
+		return nil, err
+	}
+	return config.Exchange(ctx, code, opts...)
 }
 
-// GetUserEmail receives user email after authentication on external service.
-func (c *ServiceOauth) GetUserEmail(ctx context.Context, token *oauth2.Token) (string, error) {
-	req, err := c.fn(token.AccessToken)
+// Refresh gets new token from external service using refresh token. It fails
+// if the user session is revoked by the service.
+func (c *ServiceOauth) Refresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	config, err := c.config()
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return config.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+}
+
+func (c *ServiceOauth) config() (*oauth2.Config, error) {
+	if c.clientSecret == nil {
+		return c.oauth, nil
+	}
+	secret, err := c.clientSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed generating client secret: %w", err)
+	}
+	configCopy := *c.oauth
+	configCopy.ClientSecret = secret
+	return &configCopy, nil
+}
+
+// GetUser receives user identity after authentication on external service.
+// For OpenID Connect services it's taken from the verified ID token, other
+// services are asked for user info.
+func (c *ServiceOauth) GetUser(ctx context.Context, token *oauth2.Token, login *LoginState) (*Identity, error) {
+	if c.idToken != nil {
+		rawIDToken, ok := token.Extra("id_token").(string)
+		if !ok || rawIDToken == "" {
+			return nil, fmt.Errorf("no id token in oauth response")
+		}
+		claims, err := c.idToken.verify(ctx, rawIDToken, login.Nonce)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id token: %w", err)
+		}
+		return &Identity{
+			Email:   claims.Email,
+			Subject: claims.Subject,
+			Name:    claims.Name,
+			Groups:  claims.Groups,
+		}, nil
+	}
+
+	contents, err := userInfo(ctx, c.fn, token.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := c.parse(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.profile != nil {
+		contents, err = userInfo(ctx, c.profile, token.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+		if err = c.parseProfile(contents, user); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+func userInfo(ctx context.Context, fn userInfoFn, token string) ([]byte, error) {
+	req, err := fn(token)
+	if err != nil {
+		return nil, err
 	}
 	req = req.WithContext(ctx)
 
 	client := http.DefaultClient
 	response, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed getting user info: %s", err.Error())
+		return nil, fmt.Errorf("failed getting user info: %s", err.Error())
 	}
 
 	defer response.Body.Close()
-	contents, err := io.ReadAll(response.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed reading response body: %s", err.Error())
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed getting user info: unexpected status %s", response.Status)
 	}
 
-	emailStruct := &struct {
-		Email string `json:"email"`
-	}{}
-
-	if err = json.Unmarshal(contents, emailStruct); err != nil {
-		return "", err
+	contents, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading response body: %s", err.Error())
 	}
-
-	return emailStruct.Email, nil
+	return contents, nil
 }
 
 func googleRequest(token string) (*http.Request, error) {
@@ -129,7 +377,15 @@ func googleRequest(token string) (*http.Request, error) {
 }
 
 func githubRequest(token string) (*http.Request, error) {
-	req, err := http.NewRequest(http.MethodGet, "https://api.github.com/user", nil)
+	return githubAPIRequest("https://api.github.com/user/emails", token)
+}
+
+func githubUserRequest(token string) (*http.Request, error) {
+	return githubAPIRequest("https://api.github.com/user", token)
+}
+
+func githubAPIRequest(url, token string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -137,3 +393,53 @@ func githubRequest(token string) (*http.Request, error) {
 	req.Header.Set("Authorization", "token "+token)
 	return req, nil
 }
+
+func googleUser(data []byte) (*Identity, error) {
+	var info struct {
+		ID            string `json:"id"`
+		Email         string `json:"email"`
+		VerifiedEmail bool   `json:"verified_email"`
+		Name          string `json:"name"`
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	if info.Email == "" || !info.VerifiedEmail {
+		return nil, errUnverifiedEmail
+	}
+	return &Identity{Email: info.Email, Subject: info.ID, Name: info.Name}, nil
+}
+
+func githubUser(data []byte) (*Identity, error) {
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := json.Unmarshal(data, &emails); err != nil {
+		return nil, err
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			return &Identity{Email: e.Email}, nil
+		}
+	}
+	return nil, errUnverifiedEmail
+}
+
+func githubProfile(data []byte, user *Identity) error {
+	var info struct {
+		ID    json.Number `json:"id"`
+		Login string      `json:"login"`
+		Name  string      `json:"name"`
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return err
+	}
+	if info.ID == "" {
+		return fmt.Errorf("no user id in github response")
+	}
+	user.Subject = info.ID.String()
+	user.Name = cmp.Or(info.Name, info.Login)
+	return nil
+}
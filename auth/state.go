@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// StateStorage keeps login states between login and callback requests.
+type StateStorage interface {
+	// Put saves login state and returns a value to be used as oauth state.
+	Put(login *LoginState) (string, error)
+	// Take returns login state saved for the oauth state and invalidates it.
+	Take(state string) (*LoginState, error)
+}
+
+var errInvalidState = errors.New("invalid oauth state")
+
+// storeStateStorage is a StateStorage keeping states in Store until TTL
+// passes.
+type storeStateStorage struct {
+	ttl   time.Duration
+	store Store
+}
+
+// NewMemoryStateStorage creates in-memory state storage keeping at most
+// capacity states for ttl each. The oldest states are dropped if it's full.
+func NewMemoryStateStorage(ttl time.Duration, capacity int) StateStorage {
+	return NewStoreStateStorage(ttl, NewMemoryStore(capacity))
+}
+
+// NewStoreStateStorage creates state storage keeping states in the store for
+// ttl each.
+func NewStoreStateStorage(ttl time.Duration, store Store) StateStorage {
+	return &storeStateStorage{ttl: ttl, store: store}
+}
+
+// Put implements StateStorage.
+func (s *storeStateStorage) Put(login *LoginState) (string, error) {
+	state := randomString()
+	login.Created = time.Now()
+	data, err := json.Marshal(login)
+	if err != nil {
+		return "", err
+	}
+	if err = s.store.Put(state, data, s.ttl); err != nil {
+		return "", err
+	}
+	return state, nil
+}
+
+// Take implements StateStorage.
+func (s *storeStateStorage) Take(state string) (*LoginState, error) {
+	data, err := s.store.Take(state)
+	if err != nil {
+		return nil, errInvalidState
+	}
+	login := new(LoginState)
+	if err = json.Unmarshal(data, login); err != nil {
+		return nil, errInvalidState
+	}
+	return login, nil
+}
+
+// minStateSecretLen is a minimal length of a secret used to sign states.
+const minStateSecretLen = 16
+
+// signedStateStorage is a StateStorage keeping nothing on the service side.
+// Login state is encrypted and signed with the secret and passed as oauth
+// state itself, so any service instance sharing the secret can accept the
+// callback. States can't be invalidated, they're valid until expiration.
+type signedStateStorage struct {
+	ttl    time.Duration
+	sealer *sealer
+}
+
+// NewSignedStateStorage creates stateless storage sealing states with the
+// secret, states expire after ttl.
+func NewSignedStateStorage(ttl time.Duration, secret string) (StateStorage, error) {
+	if len(secret) < minStateSecretLen {
+		return nil, fmt.Errorf("state secret must be at least %d characters long", minStateSecretLen)
+	}
+	s, err := newSealer(secret)
+	if err != nil {
+		return nil, err
+	}
+	return &signedStateStorage{ttl: ttl, sealer: s}, nil
+}
+
+// Put implements StateStorage.
+func (s *signedStateStorage) Put(login *LoginState) (string, error) {
+	login.Created = time.Now()
+	data, err := json.Marshal(login)
+	if err != nil {
+		return "", err
+	}
+	return s.sealer.seal(data), nil
+}
+
+// Take implements StateStorage.
+func (s *signedStateStorage) Take(state string) (*LoginState, error) {
+	data, err := s.sealer.open(state)
+	if err != nil {
+		return nil, errInvalidState
+	}
+	login := new(LoginState)
+	if err = json.Unmarshal(data, login); err != nil {
+		return nil, errInvalidState
+	}
+	if time.Since(login.Created) > s.ttl {
+		return nil, errInvalidState
+	}
+	return login, nil
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoreStateStorage(t *testing.T) {
+	s := NewMemoryStateStorage(time.Minute, 10)
+
+	state, err := s.Put(&LoginState{Service: "google", ReturnTo: "/send/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	login, err := s.Take(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login.Service != "google" || login.ReturnTo != "/send/" || login.Created.IsZero() {
+		t.Fatalf("unexpected login %+v", login)
+	}
+
+	for _, state := range []string{state, "", "unknown"} {
+		if _, err = s.Take(state); !errors.Is(err, errInvalidState) {
+			t.Fatalf("state %q: expected %v, got %v", state, errInvalidState, err)
+		}
+	}
+
+	expiring := NewMemoryStateStorage(-time.Second, 10)
+	if state, err = expiring.Put(&LoginState{Service: "google"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = expiring.Take(state); !errors.Is(err, errInvalidState) {
+		t.Fatalf("expired state: expected %v, got %v", errInvalidState, err)
+	}
+}
+
+func TestSignedStateStorage(t *testing.T) {
+	const secret = "state-secret-for-tests"
+	if _, err := NewSignedStateStorage(time.Minute, "short"); err == nil {
+		t.Fatal("short secret must be rejected")
+	}
+	storage, err := NewSignedStateStorage(time.Minute, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := storage.(*signedStateStorage)
+
+	state, err := s.Put(&LoginState{Service: "google", Container: "archive"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	login, err := s.Take(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login.Service != "google" || login.Container != "archive" {
+		t.Fatalf("unexpected login %+v", login)
+	}
+
+	sealState := func(login *LoginState) string {
+		data, err := json.Marshal(login)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.sealer.seal(data)
+	}
+	other, err := NewSignedStateStorage(time.Minute, "another-state-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		state   string
+		storage StateStorage
+	}{
+		{name: "tampered", state: state[:len(state)-2] + "AA"},
+		{name: "expired", state: sealState(&LoginState{Service: "google", Created: time.Now().Add(-2 * time.Minute)})},
+		{name: "not json", state: s.sealer.seal([]byte("state"))},
+		{name: "unsealed", state: "state"},
+		{name: "another secret", state: state, storage: other},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := StateStorage(s)
+			if tc.storage != nil {
+				storage = tc.storage
+			}
+			if _, err := storage.Take(tc.state); !errors.Is(err, errInvalidState) {
+				t.Fatalf("expected %v, got %v", errInvalidState, err)
+			}
+		})
+	}
+}
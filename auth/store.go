@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// defaultStoreCapacity is a capacity of memory stores used if no store is
+// configured.
+const defaultStoreCapacity = 10000
+
+// ErrNotFound is returned by Store if there is no value under the key or it's
+// expired.
+var ErrNotFound = errors.New("not found")
+
+// Store keeps short-lived values between requests. Implementations must be
+// safe for concurrent use. To run several service instances behind a load
+// balancer, all of them must use the same shared Store.
+type Store interface {
+	// Put saves value under the key for ttl replacing the previous one.
+	Put(key string, value []byte, ttl time.Duration) error
+	// Get returns value saved under the key.
+	Get(key string) ([]byte, error)
+	// Take returns value saved under the key and deletes it, so only one of
+	// concurrent callers gets the value.
+	Take(key string) ([]byte, error)
+}
+
+// memoryStore is an in-memory Store keeping limited number of values. The
+// oldest values are evicted to save new ones if it's full, so flooding the
+// service can't block new logins.
+type memoryStore struct {
+	capacity int
+
+	m       sync.Mutex
+	entries map[string]*list.Element
+	// queue keeps entries in order of saving, so the oldest ones are in front.
+	queue *list.List
+}
+
+type memoryStoreEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryStore creates in-memory store keeping at most capacity values.
+func NewMemoryStore(capacity int) Store {
+	return &memoryStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		queue:    list.New(),
+	}
+}
+
+// Put implements Store.
+func (s *memoryStore) Put(key string, value []byte, ttl time.Duration) error {
+	now := time.Now()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		s.remove(el)
+	}
+	s.removeExpired(now)
+	for s.queue.Len() >= s.capacity && s.queue.Len() > 0 {
+		s.remove(s.queue.Front())
+	}
+
+	s.entries[key] = s.queue.PushBack(&memoryStoreEntry{key: key, value: value, expires: now.Add(ttl)})
+	return nil
+}
+
+// Get implements Store.
+func (s *memoryStore) Get(key string) ([]byte, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok || time.Now().After(el.Value.(*memoryStoreEntry).expires) {
+		return nil, ErrNotFound
+	}
+	return el.Value.(*memoryStoreEntry).value, nil
+}
+
+// Take implements Store.
+func (s *memoryStore) Take(key string) ([]byte, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	s.remove(el)
+
+	entry := el.Value.(*memoryStoreEntry)
+	if time.Now().After(entry.expires) {
+		return nil, ErrNotFound
+	}
+	return entry.value, nil
+}
+
+func (s *memoryStore) remove(el *list.Element) {
+	delete(s.entries, el.Value.(*memoryStoreEntry).key)
+	s.queue.Remove(el)
+}
+
+// removeExpired drops expired entries from the front of the queue. Entries
+// saved with longer ttl can keep later expired ones, they're dropped on
+// access or eviction then.
+func (s *memoryStore) removeExpired(now time.Time) {
+	for el := s.queue.Front(); el != nil; el = s.queue.Front() {
+		if !now.After(el.Value.(*memoryStoreEntry).expires) {
+			return
+		}
+		s.remove(el)
+	}
+}
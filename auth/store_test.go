@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// checkStored checks that store has the value under the key, nil value means
+// there must be none.
+func checkStored(t *testing.T, s Store, key string, value []byte) {
+	t.Helper()
+	res, err := s.Get(key)
+	switch {
+	case value == nil && !errors.Is(err, ErrNotFound):
+		t.Fatalf("%s: expected not found, got %q, %v", key, res, err)
+	case value != nil && err != nil:
+		t.Fatalf("%s: %v", key, err)
+	case value != nil && string(res) != string(value):
+		t.Fatalf("%s: expected %q, got %q", key, value, res)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore(10)
+
+	checkStored(t, s, "key", nil)
+	if _, err := s.Take("key"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	for _, value := range []string{"first", "second"} {
+		if err := s.Put("key", []byte(value), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		checkStored(t, s, "key", []byte(value))
+	}
+
+	value, err := s.Take("key")
+	if err != nil || string(value) != "second" {
+		t.Fatalf("unexpected taken value %q, %v", value, err)
+	}
+	checkStored(t, s, "key", nil)
+	if _, err = s.Take("key"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("value must be taken once, got %v", err)
+	}
+}
+
+func TestMemoryStoreEviction(t *testing.T) {
+	s := NewMemoryStore(3)
+	put := func(keys ...string) {
+		t.Helper()
+		for _, key := range keys {
+			if err := s.Put(key, []byte(key), time.Minute); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	put("a", "b", "c", "d")
+	checkStored(t, s, "a", nil)
+	for _, key := range []string{"b", "c", "d"} {
+		checkStored(t, s, key, []byte(key))
+	}
+
+	// Replaced value is the newest one.
+	put("b", "e")
+	checkStored(t, s, "c", nil)
+	for _, key := range []string{"b", "d", "e"} {
+		checkStored(t, s, key, []byte(key))
+	}
+
+	// Taken values free space.
+	if _, err := s.Take("d"); err != nil {
+		t.Fatal(err)
+	}
+	put("f")
+	for _, key := range []string{"b", "e", "f"} {
+		checkStored(t, s, key, []byte(key))
+	}
+}
+
+func TestMemoryStoreTTL(t *testing.T) {
+	s := NewMemoryStore(3)
+
+	for i, ttl := range []time.Duration{-time.Second, time.Minute, -time.Second} {
+		if err := s.Put(fmt.Sprintf("key%d", i), []byte("value"), ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkStored(t, s, "key0", nil)
+	checkStored(t, s, "key1", []byte("value"))
+	checkStored(t, s, "key2", nil)
+	if _, err := s.Take("key2"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expired value must not be taken, got %v", err)
+	}
+
+	// Expired values are dropped before live ones are evicted.
+	for _, key := range []string{"new1", "new2"} {
+		if err := s.Put(key, []byte("value"), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, key := range []string{"key1", "new1", "new2"} {
+		checkStored(t, s, key, []byte("value"))
+	}
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/nspcc-dev/neofs-oauthz/bearer"
+)
+
+// Kinds of issued tokens.
+const (
+	TokenBearer  = "bearer"
+	TokenSession = "session"
+)
+
+var errTokenKindNotAllowed = errors.New("token kind is not allowed")
+
+// issuer issues tokens of allowed kinds with the same bearer config.
+type issuer struct {
+	bearer *bearer.Generator
+	// session is nil if session tokens are not allowed.
+	session *bearer.SessionGenerator
+	// kinds are allowed token kinds, the first one is used by default.
+	kinds []string
+}
+
+func newIssuer(config *bearer.Config, kinds []string) (*issuer, error) {
+	if len(kinds) == 0 {
+		kinds = []string{TokenBearer}
+	}
+	for _, kind := range kinds {
+		if kind != TokenBearer && kind != TokenSession {
+			return nil, fmt.Errorf("unsupported token kind '%s'", kind)
+		}
+	}
+
+	generator, err := bearer.NewGenerator(config)
+	if err != nil {
+		return nil, err
+	}
+	var session *bearer.SessionGenerator
+	if slices.Contains(kinds, TokenSession) {
+		if session, err = bearer.NewSessionGenerator(config); err != nil {
+			return nil, err
+		}
+	}
+	return &issuer{
+		bearer:  generator,
+		session: session,
+		kinds:   kinds,
+	}, nil
+}
+
+// kind returns requested token kind or the default one if it's empty.
+func (i *issuer) kind(requested string) (string, error) {
+	if requested == "" {
+		return i.kinds[0], nil
+	}
+	if !slices.Contains(i.kinds, requested) {
+		return "", errTokenKindNotAllowed
+	}
+	return requested, nil
+}
+
+// issue generates token of the kind.
+func (i *issuer) issue(kind string, params bearer.Params, currentEpoch uint64, msPerEpoch int64) (*bearer.Token, error) {
+	if kind == TokenSession {
+		return i.session.NewSession(params, currentEpoch)
+	}
+	return i.bearer.NewBearer(params, currentEpoch, msPerEpoch)
+}
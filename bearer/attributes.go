@@ -0,0 +1,119 @@
+package bearer
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Values of extra attributes required on upload.
+const (
+	// AttributeProvider is a name of external service user logged in with.
+	AttributeProvider = "provider"
+	// AttributeSubject is a user ID in external service.
+	AttributeSubject = "subject"
+	// AttributeNameHash is a hex encoded SHA-256 hash of user display name.
+	AttributeNameHash = "name_hash"
+)
+
+// Attribute is an extra object attribute required by default table.
+type Attribute struct {
+	// Name is an attribute key.
+	Name string
+	// Value is one of AttributeProvider, AttributeSubject, AttributeNameHash.
+	Value string
+}
+
+// ErrMissingAttribute is returned if external service provides no value of
+// required attribute for the user.
+var ErrMissingAttribute = errors.New("missing attribute value")
+
+// validateAttributes checks extra attributes of default table.
+func (c *Config) validateAttributes() error {
+	names := map[string]struct{}{c.EmailAttr: {}}
+	for _, attr := range c.Attributes {
+		if _, ok := attributeTemplates[attr.Value]; !ok {
+			return fmt.Errorf("unsupported attribute value '%s'", attr.Value)
+		}
+		if !isCookieName(attr.Name) {
+			return fmt.Errorf("invalid name of '%s' attribute, it must be a valid cookie name", attr.Value)
+		}
+		if _, ok := names[attr.Name]; ok {
+			return fmt.Errorf("duplicate attribute '%s'", attr.Name)
+		}
+		names[attr.Name] = struct{}{}
+	}
+	return nil
+}
+
+// isCookieName checks that the name is an RFC 7230 token, so values can be
+// returned in X-Attribute-<name> cookies.
+func isCookieName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range []byte(name) {
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"(),/:;<=>?@[\]{}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// attributeValues returns values of extra attributes by names.
+func (c *Config) attributeValues(params Params) (map[string]string, error) {
+	if len(c.Attributes) == 0 {
+		return nil, nil
+	}
+
+	res := make(map[string]string, len(c.Attributes))
+	for _, attr := range c.Attributes {
+		value := params.attribute(attr.Value)
+		if value == "" {
+			return nil, fmt.Errorf("%w: %s", ErrMissingAttribute, attr.Value)
+		}
+		res[attr.Name] = value
+	}
+	return res, nil
+}
+
+func (p Params) attribute(kind string) string {
+	switch kind {
+	case AttributeProvider:
+		return p.Provider
+	case AttributeSubject:
+		return p.Subject
+	case AttributeNameHash:
+		return p.nameHash()
+	default:
+		return ""
+	}
+}
+
+func (p Params) nameHash() string {
+	if p.Name == "" {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(p.Name)))
+}
+
+// attributeTemplates are TemplateData fields with attribute values.
+var attributeTemplates = map[string]string{
+	AttributeProvider: "{{.Provider}}",
+	AttributeSubject:  "{{.Subject}}",
+	AttributeNameHash: "{{.NameHash}}",
+}
+
+// attributeFilters returns filters requiring extra attributes.
+func attributeFilters(attrs []Attribute) []FilterTemplate {
+	res := make([]FilterTemplate, 0, len(attrs))
+	for _, attr := range attrs {
+		res = append(res, FilterTemplate{
+			Key:   attr.Name,
+			Match: "string_equal",
+			Value: attributeTemplates[attr.Value],
+		})
+	}
+	return res
+}
@@ -1,30 +1,50 @@
 package bearer
 
 import (
-	"crypto/sha256"
+	"crypto/ecdsa"
 	"encoding/base64"
 	"fmt"
-	"strconv"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/nspcc-dev/neo-go/pkg/crypto/keys"
 	"github.com/nspcc-dev/neofs-sdk-go/bearer"
 	cid "github.com/nspcc-dev/neofs-sdk-go/container/id"
 	"github.com/nspcc-dev/neofs-sdk-go/eacl"
-	"github.com/nspcc-dev/neofs-sdk-go/object"
 	"github.com/nspcc-dev/neofs-sdk-go/user"
 )
 
 // Generator is bearer token generator.
 type Generator struct {
-	config *Config
+	config  *Config
+	records []recordTemplate
 }
 
-type newRecordFun func() eacl.Record
-
 // NewGenerator creates new bearer token generator using config.
-func NewGenerator(config *Config) *Generator {
-	return &Generator{config: config}
+func NewGenerator(config *Config) (*Generator, error) {
+	if err := config.validateAttributes(); err != nil {
+		return nil, err
+	}
+
+	templates := config.Records
+	if len(templates) == 0 {
+		if err := config.validateDefaults(); err != nil {
+			return nil, err
+		}
+		templates = defaultRecords(config)
+	} else if len(config.UserOperations) != 0 || len(config.AllowedContentTypes) != 0 || len(config.DeniedContentTypes) != 0 {
+		return nil, fmt.Errorf("user operations and content types can't be used with custom eacl records")
+	} else if len(config.Attributes) != 0 {
+		return nil, fmt.Errorf("attributes can't be used with custom eacl records, use template fields instead")
+	}
+
+	records, err := compileRecords(templates, len(config.LegacyIdentities))
+	if err != nil {
+		return nil, fmt.Errorf("invalid eacl records: %w", err)
+	}
+
+	return &Generator{config: config, records: records}, nil
 }
 
 // Config for bearer token generator.
@@ -36,71 +56,152 @@ type Config struct {
 	LifeTime          uint64
 	MaxObjectSize     uint64
 	ObjectMaxLifetime time.Duration
+	// Records describe eACL table of issued tokens, default table allowing
+	// uploads only is used if empty.
+	Records []RecordTemplate
+	// UserOperations are operations besides put allowed on objects of the
+	// user by default table.
+	UserOperations []string
+	// AllowedContentTypes are the only content types of objects allowed to
+	// be uploaded by default table if set.
+	AllowedContentTypes []string
+	// DeniedContentTypes are content types of objects denied to be uploaded
+	// by default table. HTML and JavaScript are denied if neither allowed
+	// nor denied types are set.
+	DeniedContentTypes []string
+	// Identity encodes user identity into EmailAttr value, SHA-256 hash of
+	// email is used if nil.
+	Identity IdentityEncoder
+	// LegacyIdentities are encoders used before, user operations are allowed
+	// on objects with their values by default table.
+	LegacyIdentities []IdentityEncoder
+	// Attributes are extra object attributes required on upload by default
+	// table.
+	Attributes []Attribute
+	// SessionUnrestricted allows session tokens. They don't limit object
+	// size, lifetime and content type, so it must be set explicitly.
+	SessionUnrestricted bool
 }
 
-func (b *Generator) createRecords(hashedEmail string, currentEpoch uint64, msPerEpoch int64) []newRecordFun {
-	records := []newRecordFun{
-		func() eacl.Record {
-			rec := eacl.ConstructRecord(eacl.ActionDeny, eacl.OperationPut, []eacl.Target{eacl.NewTargetByRole(eacl.RoleOthers)})
-			rec.SetFilters([]eacl.Filter{eacl.NewObjectPropertyFilter(object.AttributeContentType, eacl.MatchNotPresent, "")})
-
-			return rec
-		},
-		func() eacl.Record {
-			epochs := uint64(b.config.ObjectMaxLifetime.Milliseconds() / msPerEpoch)
-			maxExpirationEpoch := strconv.FormatUint(currentEpoch+b.config.LifeTime+epochs, 10)
-
-			// order of rec is important
-			rec := eacl.ConstructRecord(eacl.ActionAllow, eacl.OperationPut, []eacl.Target{eacl.NewTargetByRole(eacl.RoleOthers)})
-			filters := []eacl.Filter{
-				eacl.NewObjectPropertyFilter(b.config.EmailAttr, eacl.MatchStringEqual, hashedEmail),
-				eacl.NewObjectPropertyFilter(object.AttributeContentType, eacl.MatchStringNotEqual, "application/javascript"),
-				eacl.NewObjectPropertyFilter(object.AttributeContentType, eacl.MatchStringNotEqual, "application/x-javascript"),
-				eacl.NewObjectPropertyFilter(object.AttributeContentType, eacl.MatchStringNotEqual, "text/javascript"),
-				eacl.NewObjectPropertyFilter(object.AttributeContentType, eacl.MatchStringNotEqual, "application/xhtml+xml"),
-				eacl.NewObjectPropertyFilter(object.AttributeContentType, eacl.MatchStringNotEqual, "text/html"),
-				eacl.NewObjectPropertyFilter(object.AttributeContentType, eacl.MatchStringNotEqual, "text/htmlh"),
-				eacl.NewObjectPropertyFilter(object.AttributeContentType, eacl.MatchStringNotEqual, ""),
-				eacl.NewFilterObjectPayloadSizeIs(eacl.MatchNumLE, b.config.MaxObjectSize),
-				eacl.NewObjectPropertyFilter(object.AttributeExpirationEpoch, eacl.MatchNumLE, maxExpirationEpoch),
-			}
-			rec.SetFilters(filters)
-
-			return rec
-		},
-		func() eacl.Record {
-			return eacl.ConstructRecord(eacl.ActionDeny, eacl.OperationPut, []eacl.Target{eacl.NewTargetByRole(eacl.RoleOthers)})
-		},
+// validateDefaults checks parameters of default table.
+func (c *Config) validateDefaults() error {
+	for _, op := range c.UserOperations {
+		if strings.EqualFold(op, "put") {
+			return fmt.Errorf("put can't be a user operation, it's always allowed")
+		}
+		// Search requests carry no object headers, so it can't be limited
+		// to objects of the user and would be allowed container-wide.
+		if strings.EqualFold(op, "search") {
+			return fmt.Errorf("search can't be a user operation, it can't be limited to objects of the user")
+		}
+	}
+	for _, contentType := range c.DeniedContentTypes {
+		if slices.Contains(c.AllowedContentTypes, contentType) {
+			return fmt.Errorf("content type '%s' is both allowed and denied", contentType)
+		}
+	}
+	if slices.Contains(c.AllowedContentTypes, "") {
+		return fmt.Errorf("empty content type can't be allowed")
 	}
+	return nil
+}
+
+// Params are parameters of the token issued to a particular user.
+type Params struct {
+	Email string
+	// Subject is a user ID in external service, Provider is a name of the
+	// service.
+	Subject  string
+	Provider string
+	// Name is a user display name.
+	Name string
+	// ContainerID is a container the token is issued for, Config.ContainerID
+	// is used if zero.
+	ContainerID cid.ID
+	// UserID is a user the token is issued for, Config.UserID is used if zero.
+	UserID user.ID
+	// PublicKey is a key of the user, required for session tokens.
+	PublicKey *ecdsa.PublicKey
+}
 
-	return records
+// Token is an issued token.
+type Token struct {
+	// Value is a base64 encoded token.
+	Value string
+	// Identity is a value of the identity attribute, empty for session
+	// tokens.
+	Identity string
+	// Attributes are values of extra attributes by names.
+	Attributes map[string]string
+	// Expiration is the last epoch of the token validity.
+	Expiration uint64
+	// ContainerID is a container the token is issued for.
+	ContainerID cid.ID
+	// Owner is a user the token is issued for, zero if anyone can use it.
+	Owner user.ID
 }
 
-// NewBearer generates new token for supplied email.
-func (b *Generator) NewBearer(email string, currentEpoch uint64, msPerEpoch int64) (string, string, error) {
+// NewBearer generates new token for supplied user.
+func (b *Generator) NewBearer(params Params, currentEpoch uint64, msPerEpoch int64) (*Token, error) {
 	var (
-		hashedEmail = fmt.Sprintf("%x", sha256.Sum256([]byte(email)))
-		records     = b.createRecords(hashedEmail, currentEpoch, msPerEpoch)
-		eaclRecords = make([]eacl.Record, 0, len(records))
+		epochs     = uint64(b.config.ObjectMaxLifetime.Milliseconds() / msPerEpoch)
+		expiration = currentEpoch + b.config.LifeTime
 	)
 
-	for _, record := range records {
-		eaclRecords = append(eaclRecords, record())
+	identity, legacy, err := b.config.identities(params)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := b.config.attributeValues(params)
+	if err != nil {
+		return nil, err
 	}
 
+	eaclRecords, err := renderRecords(b.records, TemplateData{
+		EmailAttr:          b.config.EmailAttr,
+		HashedEmail:        identity,
+		LegacyIdentities:   legacy,
+		Provider:           params.Provider,
+		Subject:            params.Subject,
+		NameHash:           params.nameHash(),
+		CurrentEpoch:       currentEpoch,
+		ExpirationEpoch:    expiration,
+		MaxExpirationEpoch: expiration + epochs,
+		MaxObjectSize:      b.config.MaxObjectSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed rendering eacl records: %w", err)
+	}
+
+	containerID := params.ContainerID
+	if containerID.IsZero() {
+		containerID = b.config.ContainerID
+	}
 	t := eacl.ConstructTable(eaclRecords)
-	t.SetCID(b.config.ContainerID)
+	t.SetCID(containerID)
+
+	owner := params.UserID
+	if owner.IsZero() && b.config.UserID != nil {
+		owner = *b.config.UserID
+	}
 
 	var bt bearer.Token
 	bt.SetEACLTable(t)
-	if b.config.UserID != nil {
-		bt.ForUser(*b.config.UserID)
+	if !owner.IsZero() {
+		bt.ForUser(owner)
 	}
-	bt.SetExp(currentEpoch + b.config.LifeTime)
+	bt.SetExp(expiration)
 
 	if err := bt.Sign(user.NewAutoIDSignerRFC6979(b.config.Key.PrivateKey)); err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	return base64.StdEncoding.EncodeToString(bt.Marshal()), hashedEmail, nil
+	return &Token{
+		Value:       base64.StdEncoding.EncodeToString(bt.Marshal()),
+		Identity:    identity,
+		Attributes:  attributes,
+		Expiration:  expiration,
+		ContainerID: containerID,
+		Owner:       owner,
+	}, nil
 }
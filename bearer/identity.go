@@ -0,0 +1,90 @@
+package bearer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Supported identity encodings.
+const (
+	// IdentitySHA256 is a hex encoded SHA-256 hash of email.
+	IdentitySHA256 = "sha256"
+	// IdentityHMACSHA256 is a hex encoded HMAC-SHA-256 of email with secret.
+	IdentityHMACSHA256 = "hmac-sha256"
+	// IdentityPlain is email as is.
+	IdentityPlain = "plain"
+	// IdentitySubject is user ID in external service prefixed with the
+	// service name.
+	IdentitySubject = "subject"
+)
+
+// minIdentitySecretLen is a minimal length of HMAC secret.
+const minIdentitySecretLen = 16
+
+// IdentityEncoder encodes user identity into value of the identity attribute.
+type IdentityEncoder func(params Params) (string, error)
+
+// errNoSubject is returned by IdentitySubject encoder if external service
+// provides no user ID.
+var errNoSubject = fmt.Errorf("%w: %s", ErrMissingAttribute, AttributeSubject)
+
+// NewIdentityEncoder creates encoder of the given encoding, secret is used by
+// IdentityHMACSHA256 only.
+func NewIdentityEncoder(encoding, secret string) (IdentityEncoder, error) {
+	switch encoding {
+	case "", IdentitySHA256:
+		return sha256Identity, nil
+	case IdentityHMACSHA256:
+		if len(secret) < minIdentitySecretLen {
+			return nil, fmt.Errorf("identity secret must be at least %d characters long", minIdentitySecretLen)
+		}
+		return func(params Params) (string, error) {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write([]byte(params.Email))
+			return hex.EncodeToString(mac.Sum(nil)), nil
+		}, nil
+	case IdentityPlain:
+		return func(params Params) (string, error) {
+			return params.Email, nil
+		}, nil
+	case IdentitySubject:
+		return func(params Params) (string, error) {
+			if params.Subject == "" {
+				return "", errNoSubject
+			}
+			return params.Provider + ":" + params.Subject, nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported identity encoding '%s'", encoding)
+	}
+}
+
+func sha256Identity(params Params) (string, error) {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(params.Email))), nil
+}
+
+// identities returns current and legacy encoded identities of the user.
+func (c *Config) identities(params Params) (string, []string, error) {
+	encode := c.Identity
+	if encode == nil {
+		encode = sha256Identity
+	}
+	identity, err := encode(params)
+	if err != nil {
+		return "", nil, err
+	}
+
+	legacy := make([]string, 0, len(c.LegacyIdentities))
+	for _, encode := range c.LegacyIdentities {
+		// Legacy identity can't be computed for some users (e.g. there is no
+		// subject), current one is used then, so records grant nothing more.
+		value, err := encode(params)
+		if err != nil {
+			value = identity
+		}
+		legacy = append(legacy, value)
+	}
+	return identity, legacy, nil
+}
@@ -0,0 +1,38 @@
+package bearer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIdentityEncoder(t *testing.T) {
+	params := Params{Email: "user@example.com", Subject: "42", Provider: "google"}
+
+	for _, tc := range []struct {
+		encoding string
+		secret   string
+		params   Params
+		expected string
+		err      error
+	}{
+		{encoding: "", params: params, expected: "b4c9a289323b21a01c3e940f150eb9b8c542587f1abfd8f0e1cc1ffc5e475514"},
+		{encoding: IdentitySHA256, params: params, expected: "b4c9a289323b21a01c3e940f150eb9b8c542587f1abfd8f0e1cc1ffc5e475514"},
+		{encoding: IdentityPlain, params: params, expected: "user@example.com"},
+		{encoding: IdentitySubject, params: params, expected: "google:42"},
+		{encoding: IdentitySubject, params: Params{Email: "user@example.com", Provider: "google"}, err: ErrMissingAttribute},
+	} {
+		t.Run(tc.encoding, func(t *testing.T) {
+			encode, err := NewIdentityEncoder(tc.encoding, tc.secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := encode(tc.params)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if res != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, res)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package bearer
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"github.com/google/uuid"
+	neofsecdsa "github.com/nspcc-dev/neofs-sdk-go/crypto/ecdsa"
+	"github.com/nspcc-dev/neofs-sdk-go/session"
+	"github.com/nspcc-dev/neofs-sdk-go/user"
+)
+
+// SessionGenerator is object session token generator. Session tokens allow
+// uploading objects on behalf of the service wallet, they're not limited by
+// eACL records, so object size, lifetime, content type and attributes are not
+// checked.
+type SessionGenerator struct {
+	config *Config
+}
+
+var errNoPublicKey = errors.New("session token requires user public key")
+
+// NewSessionGenerator creates new session token generator using config. Config
+// restricting uploads in a way session tokens can't enforce is rejected, and
+// default limits are ignored only if SessionUnrestricted is set.
+func NewSessionGenerator(config *Config) (*SessionGenerator, error) {
+	switch {
+	case !config.SessionUnrestricted:
+		return nil, errors.New("session tokens don't limit object size, lifetime and content type, they must be allowed explicitly")
+	case len(config.Records) != 0:
+		return nil, errors.New("session tokens can't be used with custom eacl records")
+	case len(config.AllowedContentTypes) != 0 || len(config.DeniedContentTypes) != 0:
+		return nil, errors.New("session tokens can't be used with content types")
+	case len(config.Attributes) != 0:
+		return nil, errors.New("session tokens can't be used with attributes")
+	}
+	return &SessionGenerator{config: config}, nil
+}
+
+// NewSession generates new object session token for put operations in the
+// container, usable by the owner of params.PublicKey only. Uploaded objects
+// aren't bound to user identity, so the token has neither identity nor
+// attributes.
+func (g *SessionGenerator) NewSession(params Params, currentEpoch uint64) (*Token, error) {
+	if params.PublicKey == nil {
+		return nil, errNoPublicKey
+	}
+
+	expiration := currentEpoch + g.config.LifeTime
+
+	containerID := params.ContainerID
+	if containerID.IsZero() {
+		containerID = g.config.ContainerID
+	}
+
+	var st session.Object
+	st.SetID(uuid.New())
+	st.SetAuthKey((*neofsecdsa.PublicKey)(params.PublicKey))
+	st.BindContainer(containerID)
+	st.ForVerb(session.VerbObjectPut)
+	st.SetIat(currentEpoch)
+	st.SetNbf(currentEpoch)
+	st.SetExp(expiration)
+
+	if err := st.Sign(user.NewAutoIDSignerRFC6979(g.config.Key.PrivateKey)); err != nil {
+		return nil, err
+	}
+
+	return &Token{
+		Value:       base64.StdEncoding.EncodeToString(st.Marshal()),
+		Expiration:  expiration,
+		ContainerID: containerID,
+		Owner:       user.NewFromECDSAPublicKey(*params.PublicKey),
+	}, nil
+}
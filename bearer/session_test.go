@@ -0,0 +1,83 @@
+package bearer
+
+import (
+	"crypto/ecdsa"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nspcc-dev/neo-go/pkg/crypto/keys"
+	cidtest "github.com/nspcc-dev/neofs-sdk-go/container/id/test"
+)
+
+func TestNewSessionGenerator(t *testing.T) {
+	key, err := keys.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newConfig := func(modify func(*Config)) *Config {
+		config := &Config{
+			EmailAttr:           "Email",
+			Key:                 key,
+			ContainerID:         cidtest.ID(),
+			LifeTime:            30,
+			MaxObjectSize:       1 << 20,
+			ObjectMaxLifetime:   48 * time.Hour,
+			SessionUnrestricted: true,
+		}
+		if modify != nil {
+			modify(config)
+		}
+		return config
+	}
+
+	for _, tc := range []struct {
+		name   string
+		config *Config
+		err    string
+	}{
+		{name: "unrestricted", config: newConfig(nil)},
+		{name: "default limits", config: newConfig(func(c *Config) { c.SessionUnrestricted = false }), err: "must be allowed explicitly"},
+		{name: "records", config: newConfig(func(c *Config) { c.Records = []RecordTemplate{{}} }), err: "eacl records"},
+		{name: "allowed content types", config: newConfig(func(c *Config) { c.AllowedContentTypes = []string{"image/png"} }), err: "content types"},
+		{name: "denied content types", config: newConfig(func(c *Config) { c.DeniedContentTypes = []string{"text/html"} }), err: "content types"},
+		{name: "attributes", config: newConfig(func(c *Config) { c.Attributes = []Attribute{{}} }), err: "attributes"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewSessionGenerator(tc.config)
+			switch {
+			case tc.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+				t.Fatalf("expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestNewSession(t *testing.T) {
+	key, err := keys.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	generator, err := NewSessionGenerator(&Config{Key: key, ContainerID: cidtest.ID(), LifeTime: 30, SessionUnrestricted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = generator.NewSession(Params{Email: "user@example.com"}, 100); err == nil {
+		t.Fatal("session token must require public key")
+	}
+
+	userKey, err := keys.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := generator.NewSession(Params{Email: "user@example.com", PublicKey: (*ecdsa.PublicKey)(userKey.PublicKey())}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Expiration != 130 || token.Identity != "" || len(token.Attributes) != 0 {
+		t.Fatalf("unexpected token %+v", token)
+	}
+}
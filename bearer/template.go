@@ -0,0 +1,374 @@
+package bearer
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/nspcc-dev/neofs-sdk-go/eacl"
+	"github.com/nspcc-dev/neofs-sdk-go/object"
+)
+
+// RecordTemplate describes eACL record added to every issued token. Filter
+// keys and values are text/template templates rendered with TemplateData.
+type RecordTemplate struct {
+	// Action is either "allow" or "deny".
+	Action string
+	// Operations are object operations the record applies to: "get", "head",
+	// "put", "delete", "search", "range", "rangehash".
+	Operations []string
+	// Targets are roles the record applies to: "others" (default), "user".
+	Targets []string
+	Filters []FilterTemplate
+}
+
+// FilterTemplate describes filter of eACL record.
+type FilterTemplate struct {
+	// Header is a type of filtered header: "object" (default) or "request".
+	Header string
+	Key    string
+	// Match is one of "string_equal", "string_not_equal", "not_present",
+	// "num_gt", "num_ge", "num_lt", "num_le".
+	Match string
+	Value string
+}
+
+// TemplateData is data available in record templates.
+type TemplateData struct {
+	EmailAttr string
+	// HashedEmail is encoded user identity.
+	HashedEmail string
+	// LegacyIdentities are user identities encoded by legacy encoders.
+	LegacyIdentities []string
+	// Provider, Subject and NameHash are values of extra attributes.
+	Provider           string
+	Subject            string
+	NameHash           string
+	CurrentEpoch       uint64
+	ExpirationEpoch    uint64
+	MaxExpirationEpoch uint64
+	MaxObjectSize      uint64
+}
+
+type recordTemplate struct {
+	action     eacl.Action
+	operations []eacl.Operation
+	targets    []eacl.Target
+	filters    []filterTemplate
+}
+
+type filterTemplate struct {
+	header eacl.FilterHeaderType
+	key    *template.Template
+	match  eacl.Match
+	value  *template.Template
+}
+
+var (
+	actions = map[string]eacl.Action{
+		"allow": eacl.ActionAllow,
+		"deny":  eacl.ActionDeny,
+	}
+	operations = map[string]eacl.Operation{
+		"get":       eacl.OperationGet,
+		"head":      eacl.OperationHead,
+		"put":       eacl.OperationPut,
+		"delete":    eacl.OperationDelete,
+		"search":    eacl.OperationSearch,
+		"range":     eacl.OperationRange,
+		"rangehash": eacl.OperationRangeHash,
+	}
+	roles = map[string]eacl.Role{
+		"others": eacl.RoleOthers,
+		"user":   eacl.RoleUser,
+	}
+	headers = map[string]eacl.FilterHeaderType{
+		"object":  eacl.HeaderFromObject,
+		"request": eacl.HeaderFromRequest,
+	}
+	matches = map[string]eacl.Match{
+		"string_equal":     eacl.MatchStringEqual,
+		"string_not_equal": eacl.MatchStringNotEqual,
+		"not_present":      eacl.MatchNotPresent,
+		"num_gt":           eacl.MatchNumGT,
+		"num_ge":           eacl.MatchNumGE,
+		"num_lt":           eacl.MatchNumLT,
+		"num_le":           eacl.MatchNumLE,
+	}
+)
+
+// defaultRecords describes the table used when no records are configured:
+// only uploads of objects with content type, user email and limited size and
+// lifetime are allowed. User operations are allowed on objects with user
+// email only.
+func defaultRecords(config *Config) []RecordTemplate {
+	denied := config.DeniedContentTypes
+	if len(denied) == 0 && len(config.AllowedContentTypes) == 0 {
+		denied = defaultDeniedContentTypes
+	}
+
+	contentTypeFilters := make([]FilterTemplate, 0, len(denied)+1)
+	for _, contentType := range slices.Concat(denied, []string{""}) {
+		contentTypeFilters = append(contentTypeFilters, FilterTemplate{
+			Key:   object.AttributeContentType,
+			Match: "string_not_equal",
+			Value: contentType,
+		})
+	}
+
+	// order of filters is important
+	allowFilters := []FilterTemplate{{
+		Key:   "{{.EmailAttr}}",
+		Match: "string_equal",
+		Value: "{{.HashedEmail}}",
+	}}
+	allowFilters = append(allowFilters, attributeFilters(config.Attributes)...)
+	allowFilters = append(allowFilters, contentTypeFilters...)
+	allowFilters = append(allowFilters,
+		FilterTemplate{
+			Key:   eacl.FilterObjectPayloadSize,
+			Match: "num_le",
+			Value: "{{.MaxObjectSize}}",
+		},
+		FilterTemplate{
+			Key:   object.AttributeExpirationEpoch,
+			Match: "num_le",
+			Value: "{{.MaxExpirationEpoch}}",
+		},
+	)
+
+	records := []RecordTemplate{
+		{
+			Action:     "deny",
+			Operations: []string{"put"},
+			Filters: []FilterTemplate{{
+				Key:   object.AttributeContentType,
+				Match: "not_present",
+			}},
+		},
+	}
+
+	if len(config.AllowedContentTypes) != 0 {
+		// Filters of a record are combined with AND, so objects with content
+		// type not equal to every allowed one are denied.
+		notAllowed := make([]FilterTemplate, 0, len(config.AllowedContentTypes))
+		for _, contentType := range config.AllowedContentTypes {
+			notAllowed = append(notAllowed, FilterTemplate{
+				Key:   object.AttributeContentType,
+				Match: "string_not_equal",
+				Value: contentType,
+			})
+		}
+		records = append(records, RecordTemplate{
+			Action:     "deny",
+			Operations: []string{"put"},
+			Filters:    notAllowed,
+		})
+	}
+
+	records = append(records,
+		RecordTemplate{
+			Action:     "allow",
+			Operations: []string{"put"},
+			Filters:    allowFilters,
+		},
+		RecordTemplate{
+			Action:     "deny",
+			Operations: []string{"put"},
+		},
+	)
+
+	if len(config.UserOperations) == 0 {
+		return records
+	}
+
+	identities := []string{"{{.HashedEmail}}"}
+	for i := range config.LegacyIdentities {
+		identities = append(identities, fmt.Sprintf("{{index .LegacyIdentities %d}}", i))
+	}
+	for _, identity := range identities {
+		records = append(records, RecordTemplate{
+			Action:     "allow",
+			Operations: config.UserOperations,
+			Filters: []FilterTemplate{{
+				Key:   "{{.EmailAttr}}",
+				Match: "string_equal",
+				Value: identity,
+			}},
+		})
+	}
+	return append(records, RecordTemplate{
+		Action:     "deny",
+		Operations: config.UserOperations,
+	})
+}
+
+// defaultDeniedContentTypes are content types of objects that can't be
+// uploaded with the default table if no content types are configured.
+var defaultDeniedContentTypes = []string{
+	"application/javascript",
+	"application/x-javascript",
+	"text/javascript",
+	"application/xhtml+xml",
+	"text/html",
+}
+
+// compileRecords parses record templates and checks that they can be rendered
+// with the given number of legacy identities.
+func compileRecords(records []RecordTemplate, legacy int) ([]recordTemplate, error) {
+	res := make([]recordTemplate, 0, len(records))
+	for i, r := range records {
+		rec, err := compileRecord(r)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		res = append(res, rec)
+	}
+
+	// Catch errors like unknown fields or non-numeric values of numeric
+	// filters at startup rather than on token issuing.
+	sample := TemplateData{
+		EmailAttr:          "Email",
+		HashedEmail:        "hash",
+		LegacyIdentities:   make([]string, legacy),
+		Provider:           "provider",
+		Subject:            "subject",
+		NameHash:           "name",
+		CurrentEpoch:       1,
+		ExpirationEpoch:    2,
+		MaxExpirationEpoch: 3,
+		MaxObjectSize:      4,
+	}
+	if _, err := renderRecords(res, sample); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func compileRecord(r RecordTemplate) (recordTemplate, error) {
+	var (
+		rec recordTemplate
+		ok  bool
+	)
+
+	if rec.action, ok = actions[strings.ToLower(r.Action)]; !ok {
+		return rec, fmt.Errorf("unknown action '%s'", r.Action)
+	}
+
+	if len(r.Operations) == 0 {
+		return rec, fmt.Errorf("no operations")
+	}
+	for _, name := range r.Operations {
+		op, ok := operations[strings.ToLower(name)]
+		if !ok {
+			return rec, fmt.Errorf("unknown operation '%s'", name)
+		}
+		rec.operations = append(rec.operations, op)
+	}
+
+	targets := r.Targets
+	if len(targets) == 0 {
+		targets = []string{"others"}
+	}
+	for _, name := range targets {
+		role, ok := roles[strings.ToLower(name)]
+		if !ok {
+			return rec, fmt.Errorf("unknown target '%s'", name)
+		}
+		rec.targets = append(rec.targets, eacl.NewTargetByRole(role))
+	}
+
+	for i, f := range r.Filters {
+		filter, err := compileFilter(f)
+		if err != nil {
+			return rec, fmt.Errorf("filter %d: %w", i, err)
+		}
+		rec.filters = append(rec.filters, filter)
+	}
+
+	return rec, nil
+}
+
+func compileFilter(f FilterTemplate) (filterTemplate, error) {
+	var (
+		filter filterTemplate
+		ok     bool
+		err    error
+	)
+
+	header := f.Header
+	if header == "" {
+		header = "object"
+	}
+	if filter.header, ok = headers[strings.ToLower(header)]; !ok {
+		return filter, fmt.Errorf("unknown header type '%s'", f.Header)
+	}
+	if filter.match, ok = matches[strings.ToLower(f.Match)]; !ok {
+		return filter, fmt.Errorf("unknown match '%s'", f.Match)
+	}
+	if f.Key == "" {
+		return filter, fmt.Errorf("empty key")
+	}
+	if filter.key, err = newTemplate(f.Key); err != nil {
+		return filter, fmt.Errorf("invalid key: %w", err)
+	}
+	if filter.value, err = newTemplate(f.Value); err != nil {
+		return filter, fmt.Errorf("invalid value: %w", err)
+	}
+
+	return filter, nil
+}
+
+func newTemplate(text string) (*template.Template, error) {
+	return template.New("").Option("missingkey=error").Parse(text)
+}
+
+func renderRecords(records []recordTemplate, data TemplateData) ([]eacl.Record, error) {
+	res := make([]eacl.Record, 0, len(records))
+	for i, rec := range records {
+		filters := make([]eacl.Filter, 0, len(rec.filters))
+		for j, f := range rec.filters {
+			filter, err := f.render(data)
+			if err != nil {
+				return nil, fmt.Errorf("record %d: filter %d: %w", i, j, err)
+			}
+			filters = append(filters, filter)
+		}
+
+		for _, op := range rec.operations {
+			res = append(res, eacl.ConstructRecord(rec.action, op, rec.targets, filters...))
+		}
+	}
+	return res, nil
+}
+
+func (f filterTemplate) render(data TemplateData) (eacl.Filter, error) {
+	key, err := execute(f.key, data)
+	if err != nil {
+		return eacl.Filter{}, err
+	}
+	value, err := execute(f.value, data)
+	if err != nil {
+		return eacl.Filter{}, err
+	}
+
+	switch f.match {
+	case eacl.MatchNumGT, eacl.MatchNumGE, eacl.MatchNumLT, eacl.MatchNumLE:
+		if _, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return eacl.Filter{}, fmt.Errorf("non-numeric value '%s' for numeric match", value)
+		}
+	}
+
+	return eacl.ConstructFilter(f.header, key, f.match, value), nil
+}
+
+func execute(t *template.Template, data TemplateData) (string, error) {
+	var sb strings.Builder
+	if err := t.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
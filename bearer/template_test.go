@@ -0,0 +1,135 @@
+package bearer
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nspcc-dev/neo-go/pkg/crypto/keys"
+	"github.com/nspcc-dev/neofs-sdk-go/bearer"
+	cidtest "github.com/nspcc-dev/neofs-sdk-go/container/id/test"
+	"github.com/nspcc-dev/neofs-sdk-go/eacl"
+	"github.com/nspcc-dev/neofs-sdk-go/object"
+)
+
+// droppedBaselineFilter is a typo filter of the baseline table allowing
+// nothing on its own, it's the only filter not issued anymore.
+var droppedBaselineFilter = eacl.NewObjectPropertyFilter(object.AttributeContentType, eacl.MatchStringNotEqual, "text/htmlh")
+
+// baselineRecords is the table issued before eACL became configurable.
+func baselineRecords(config *Config, hashedEmail string, currentEpoch uint64, msPerEpoch int64) []eacl.Record {
+	epochs := uint64(config.ObjectMaxLifetime.Milliseconds() / msPerEpoch)
+	maxExpirationEpoch := strconv.FormatUint(currentEpoch+config.LifeTime+epochs, 10)
+	others := []eacl.Target{eacl.NewTargetByRole(eacl.RoleOthers)}
+
+	return []eacl.Record{
+		eacl.ConstructRecord(eacl.ActionDeny, eacl.OperationPut, others,
+			eacl.NewObjectPropertyFilter(object.AttributeContentType, eacl.MatchNotPresent, ""),
+		),
+		eacl.ConstructRecord(eacl.ActionAllow, eacl.OperationPut, others,
+			eacl.NewObjectPropertyFilter(config.EmailAttr, eacl.MatchStringEqual, hashedEmail),
+			eacl.NewObjectPropertyFilter(object.AttributeContentType, eacl.MatchStringNotEqual, "application/javascript"),
+			eacl.NewObjectPropertyFilter(object.AttributeContentType, eacl.MatchStringNotEqual, "application/x-javascript"),
+			eacl.NewObjectPropertyFilter(object.AttributeContentType, eacl.MatchStringNotEqual, "text/javascript"),
+			eacl.NewObjectPropertyFilter(object.AttributeContentType, eacl.MatchStringNotEqual, "application/xhtml+xml"),
+			eacl.NewObjectPropertyFilter(object.AttributeContentType, eacl.MatchStringNotEqual, "text/html"),
+			droppedBaselineFilter,
+			eacl.NewObjectPropertyFilter(object.AttributeContentType, eacl.MatchStringNotEqual, ""),
+			eacl.NewFilterObjectPayloadSizeIs(eacl.MatchNumLE, config.MaxObjectSize),
+			eacl.NewObjectPropertyFilter(object.AttributeExpirationEpoch, eacl.MatchNumLE, maxExpirationEpoch),
+		),
+		eacl.ConstructRecord(eacl.ActionDeny, eacl.OperationPut, others),
+	}
+}
+
+func TestDefaultRecordsMatchBaseline(t *testing.T) {
+	key, err := keys.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{
+		EmailAttr:         "Email",
+		Key:               key,
+		ContainerID:       cidtest.ID(),
+		LifeTime:          30,
+		MaxObjectSize:     1 << 20,
+		ObjectMaxLifetime: 48 * time.Hour,
+	}
+	generator, err := NewGenerator(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		email        = "user@example.com"
+		currentEpoch = 100
+		msPerEpoch   = int64(time.Hour / time.Millisecond)
+	)
+	token, err := generator.NewBearer(Params{Email: email}, currentEpoch, msPerEpoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashedEmail := fmt.Sprintf("%x", sha256.Sum256([]byte(email)))
+	if token.Identity != hashedEmail {
+		t.Fatalf("identity %s doesn't match baseline %s", token.Identity, hashedEmail)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(token.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bt bearer.Token
+	if err = bt.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+
+	actual := bt.EACLTable().Records()
+	expected := baselineRecords(config, hashedEmail, currentEpoch, msPerEpoch)
+	var dropped int
+	for _, rec := range expected {
+		dropped += len(rec.Filters()) - len(withoutDroppedFilter(rec.Filters()))
+	}
+	if dropped != 1 {
+		t.Fatalf("baseline must have one dropped filter, got %d", dropped)
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d records, got %d", len(expected), len(actual))
+	}
+	for i := range expected {
+		exp, act := expected[i], actual[i]
+		if exp.Action() != act.Action() || exp.Operation() != act.Operation() {
+			t.Fatalf("record %d: expected %s %s, got %s %s", i, exp.Action(), exp.Operation(), act.Action(), act.Operation())
+		}
+		if len(act.Targets()) != 1 || act.Targets()[0].Role() != eacl.RoleOthers {
+			t.Fatalf("record %d: targets must be others only", i)
+		}
+
+		expFilters, actFilters := withoutDroppedFilter(exp.Filters()), act.Filters()
+		if len(expFilters) != len(actFilters) {
+			t.Fatalf("record %d: expected %d filters, got %d", i, len(expFilters), len(actFilters))
+		}
+		for j := range expFilters {
+			ef, af := expFilters[j], actFilters[j]
+			if ef.From() != af.From() || ef.Key() != af.Key() || ef.Matcher() != af.Matcher() || ef.Value() != af.Value() {
+				t.Errorf("record %d: filter %d: expected %s %s %s %q, got %s %s %s %q", i, j,
+					ef.From(), ef.Key(), ef.Matcher(), ef.Value(),
+					af.From(), af.Key(), af.Matcher(), af.Value())
+			}
+		}
+	}
+}
+
+// withoutDroppedFilter returns filters except droppedBaselineFilter.
+func withoutDroppedFilter(filters []eacl.Filter) []eacl.Filter {
+	res := make([]eacl.Filter, 0, len(filters))
+	for _, f := range filters {
+		if f.From() != droppedBaselineFilter.From() || f.Key() != droppedBaselineFilter.Key() ||
+			f.Matcher() != droppedBaselineFilter.Matcher() || f.Value() != droppedBaselineFilter.Value() {
+			res = append(res, f)
+		}
+	}
+	return res
+}
@@ -5,7 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/nspcc-dev/neo-go/cli/flags"
 	"github.com/nspcc-dev/neo-go/cli/input"
@@ -94,7 +97,7 @@ func newApp(ctx context.Context, opt ...Option) App {
 		a.log.Fatal("failed to get neofs credentials", zap.Error(err))
 	}
 
-	a.initAuthCfg(key)
+	a.initAuthCfg(ctx, key)
 	a.initPool(ctx, key)
 
 	return a
@@ -202,12 +205,21 @@ func (a *app) getKey() (*keys.PrivateKey, error) {
 	return account.PrivateKey(), nil
 }
 
-func (a *app) initAuthCfg(key *keys.PrivateKey) {
+func (a *app) initAuthCfg(ctx context.Context, key *keys.PrivateKey) {
 	var containerID cid.ID
 	if err := containerID.DecodeString(a.cfg.GetString(cfgContainerID)); err != nil {
 		a.log.Fatal("container id is empty or malformed", zap.Error(err))
 	}
 
+	containers := make(map[string]cid.ID)
+	for name, value := range a.cfg.GetStringMapString(cfgContainers) {
+		var id cid.ID
+		if err := id.DecodeString(value); err != nil {
+			a.log.Fatal("container id is malformed", zap.String("container", name), zap.Error(err))
+		}
+		containers[name] = id
+	}
+
 	var (
 		cfgUser = a.cfg.GetString(cfgUserID)
 		userID  *user.ID
@@ -236,6 +248,13 @@ func (a *app) initAuthCfg(key *keys.PrivateKey) {
 		objectMaxLifetime = defaultMaxObjectLifetime
 	}
 
+	identity, legacyIdentities := a.identityEncoders()
+
+	var records []bearer.RecordTemplate
+	if err := a.cfg.UnmarshalKey(cfgBearerEACL, &records); err != nil {
+		a.log.Fatal("eacl records are malformed", zap.Error(err))
+	}
+
 	listenAddress := a.cfg.GetString(cfgListenAddress)
 	if len(listenAddress) == 0 {
 		listenAddress = defaultListenAddress
@@ -245,24 +264,141 @@ func (a *app) initAuthCfg(key *keys.PrivateKey) {
 		bearerCookieName = defaultBearerCookieName
 	}
 
+	stateTTL := a.cfg.GetDuration(cfgStateTTL)
+	if stateTTL <= 0 {
+		stateTTL = defaultStateTTL
+	}
+	var stateStorage auth.StateStorage
+	switch stateType := a.cfg.GetString(cfgStateType); stateType {
+	case "", stateTypeMemory:
+		stateCapacity := a.cfg.GetInt(cfgStateCapacity)
+		if stateCapacity <= 0 {
+			stateCapacity = defaultStateCapacity
+		}
+		stateStorage = auth.NewMemoryStateStorage(stateTTL, stateCapacity)
+	case stateTypeSigned:
+		var err error
+		stateStorage, err = auth.NewSignedStateStorage(stateTTL, a.cfg.GetString(cfgStateSecret))
+		if err != nil {
+			a.log.Fatal("failed to init state storage", zap.Error(err))
+		}
+	default:
+		a.log.Fatal("unsupported state type", zap.String("type", stateType))
+	}
+
+	deviceCodeTTL := a.cfg.GetDuration(cfgDeviceCodeTTL)
+	if deviceCodeTTL <= 0 {
+		deviceCodeTTL = defaultDeviceCodeTTL
+	}
+	deviceInterval := a.cfg.GetDuration(cfgDeviceInterval)
+	if deviceInterval <= 0 {
+		deviceInterval = defaultDeviceInterval
+	}
+	deviceCapacity := a.cfg.GetInt(cfgDeviceCapacity)
+	if deviceCapacity <= 0 {
+		deviceCapacity = defaultDeviceCapacity
+	}
+
+	loopbackCodeTTL := a.cfg.GetDuration(cfgLoopbackCodeTTL)
+	if loopbackCodeTTL <= 0 {
+		loopbackCodeTTL = defaultLoopbackCodeTTL
+	}
+	loopbackCapacity := a.cfg.GetInt(cfgLoopbackCapacity)
+	if loopbackCapacity <= 0 {
+		loopbackCapacity = defaultLoopbackCapacity
+	}
+
+	refreshSessionLifetime := a.cfg.GetDuration(cfgRefreshSessionLifetime)
+	if refreshSessionLifetime <= 0 {
+		refreshSessionLifetime = defaultRefreshSessionLifetime
+	}
+	refreshCapacity := a.cfg.GetInt(cfgRefreshCapacity)
+	if refreshCapacity <= 0 {
+		refreshCapacity = defaultRefreshCapacity
+	}
+
+	tlsEnabled := a.cfg.GetString(cfgTLSCertificate) != "" || a.cfg.GetString(cfgTLSKey) != ""
+	cookieSecure := tlsEnabled
+	if a.cfg.IsSet(cfgCookieSecure) {
+		cookieSecure = a.cfg.GetBool(cfgCookieSecure)
+	}
+	var sameSite http.SameSite
+	switch mode := a.cfg.GetString(cfgCookieSameSite); strings.ToLower(mode) {
+	case "", "lax":
+		sameSite = http.SameSiteLaxMode
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	default:
+		a.log.Fatal("unsupported cookie same_site mode", zap.String("mode", mode))
+	}
+
 	a.authCfg = &auth.Config{
 		Bearer: &bearer.Config{
-			EmailAttr:         emailattr,
-			Key:               key,
-			UserID:            userID,
-			ContainerID:       containerID,
-			LifeTime:          lifetime,
-			MaxObjectSize:     maxObjectSize,
-			ObjectMaxLifetime: objectMaxLifetime,
+			EmailAttr:           emailattr,
+			Key:                 key,
+			UserID:              userID,
+			ContainerID:         containerID,
+			LifeTime:            lifetime,
+			MaxObjectSize:       maxObjectSize,
+			ObjectMaxLifetime:   objectMaxLifetime,
+			Records:             records,
+			UserOperations:      a.cfg.GetStringSlice(cfgBearerUserOperations),
+			AllowedContentTypes: a.cfg.GetStringSlice(cfgContentTypesAllow),
+			DeniedContentTypes:  a.cfg.GetStringSlice(cfgContentTypesDeny),
+			Identity:            identity,
+			LegacyIdentities:    legacyIdentities,
+			Attributes:          a.attributes(),
+			SessionUnrestricted: a.cfg.GetBool(cfgSessionUnrestricted),
 		},
 		BearerCookieName: bearerCookieName,
 		Oauth:            make(map[string]*auth.ServiceOauth),
-		TLSEnabled:       a.cfg.GetString(cfgTLSCertificate) != "" || a.cfg.GetString(cfgTLSKey) != "",
+		TLSEnabled:       tlsEnabled,
 		Host:             listenAddress,
 		RedirectURL:      a.cfg.GetString(cfgRedirectURL),
+		AllowedRedirects: a.cfg.GetStringSlice(cfgRedirectAllowed),
+		StateStorage:     stateStorage,
+		StateTTL:         stateTTL,
+		Access: auth.AccessConfig{
+			Allow:     a.cfg.GetStringSlice(cfgAccessAllow),
+			Deny:      a.cfg.GetStringSlice(cfgAccessDeny),
+			AllowFile: a.cfg.GetString(cfgAccessAllowFile),
+			DenyFile:  a.cfg.GetString(cfgAccessDenyFile),
+		},
+		Containers:  containers,
+		UserBinding: a.cfg.GetString(cfgUserBinding),
+		TokenKinds:  a.cfg.GetStringSlice(cfgTokenKinds),
+		Cookie: auth.CookieConfig{
+			Secure:   cookieSecure,
+			HTTPOnly: a.cfg.GetBool(cfgCookieHTTPOnly),
+			SameSite: sameSite,
+			Domain:   a.cfg.GetString(cfgCookieDomain),
+			Path:     a.cfg.GetString(cfgCookiePath),
+		},
+		Device: auth.DeviceConfig{
+			CodeTTL:  deviceCodeTTL,
+			Interval: deviceInterval,
+			// Every authorization is kept under device and user codes along
+			// with polling state and login result.
+			Store:           auth.NewMemoryStore(4 * deviceCapacity),
+			VerificationURI: a.cfg.GetString(cfgDeviceVerificationURI),
+		},
+		Loopback: auth.LoopbackConfig{
+			CodeTTL: loopbackCodeTTL,
+			Store:   auth.NewMemoryStore(loopbackCapacity),
+		},
+		Refresh: auth.RefreshConfig{
+			Secret:          a.cfg.GetString(cfgRefreshSecret),
+			SessionLifetime: refreshSessionLifetime,
+			Store:           auth.NewMemoryStore(refreshCapacity),
+		},
 	}
 
 	redirectURLCallback := fmt.Sprintf(callbackURLFmt, a.authCfg.RedirectURL)
+	nameHash := slices.ContainsFunc(a.authCfg.Bearer.Attributes, func(attr bearer.Attribute) bool {
+		return attr.Value == bearer.AttributeNameHash
+	})
 
 	for key := range a.cfg.GetStringMap(cfgOauth) {
 		oauth := &oauth2.Config{
@@ -276,12 +412,163 @@ func (a *app) initAuthCfg(key *keys.PrivateKey) {
 			},
 		}
 
-		if serviceConfig, err := auth.NewServiceConfig(key, oauth); err != nil {
+		serviceType := a.cfg.GetString(fmt.Sprintf(cfgOauthTypeFmt, key))
+		if len(serviceType) == 0 {
+			serviceType = key // backward compatibility with configs having no type
+		}
+		pkce := serviceType != auth.ServiceApple // Apple doesn't support PKCE
+		if pkceKey := fmt.Sprintf(cfgOauthPKCEFmt, key); a.cfg.IsSet(pkceKey) {
+			pkce = a.cfg.GetBool(pkceKey)
+		}
+		params := auth.ServiceParams{
+			Type:                  serviceType,
+			Issuer:                a.cfg.GetString(fmt.Sprintf(cfgOauthIssuerFmt, key)),
+			BaseURL:               a.cfg.GetString(fmt.Sprintf(cfgOauthBaseURLFmt, key)),
+			Tenant:                a.cfg.GetString(fmt.Sprintf(cfgOauthTenantFmt, key)),
+			TrustUnverifiedDomain: a.cfg.GetBool(fmt.Sprintf(cfgOauthTrustDomainFmt, key)),
+			Apple: auth.AppleParams{
+				TeamID:  a.cfg.GetString(fmt.Sprintf(cfgOauthTeamIDFmt, key)),
+				KeyID:   a.cfg.GetString(fmt.Sprintf(cfgOauthKeyIDFmt, key)),
+				KeyPath: a.cfg.GetString(fmt.Sprintf(cfgOauthPrivateKeyFmt, key)),
+			},
+			PKCE:    pkce,
+			Offline: a.authCfg.Refresh.Secret != "",
+			Profile: nameHash,
+			Oauth:   oauth,
+			UserInfo: auth.UserInfoParams{
+				URL:                  a.cfg.GetString(fmt.Sprintf(cfgOauthUserInfoURLFmt, key)),
+				AuthStyle:            a.cfg.GetString(fmt.Sprintf(cfgOauthAuthStyleFmt, key)),
+				EmailPath:            a.cfg.GetString(fmt.Sprintf(cfgOauthEmailPathFmt, key)),
+				EmailVerifiedPath:    a.cfg.GetString(fmt.Sprintf(cfgOauthEmailVerifiedPathFmt, key)),
+				TrustUnverifiedEmail: a.cfg.GetBool(fmt.Sprintf(cfgOauthTrustUnverifiedFmt, key)),
+				SubjectPath:          a.cfg.GetString(fmt.Sprintf(cfgOauthSubjectPathFmt, key)),
+				GroupsPath:           a.cfg.GetString(fmt.Sprintf(cfgOauthGroupsPathFmt, key)),
+				NamePath:             a.cfg.GetString(fmt.Sprintf(cfgOauthNamePathFmt, key)),
+			},
+		}
+
+		discoveryCtx, cancel := context.WithTimeout(ctx, defaultRequestTimeout)
+		serviceConfig, err := auth.NewServiceConfig(discoveryCtx, key, params)
+		cancel()
+		if err != nil {
 			a.log.Fatal("failed to init services", zap.Error(err))
-		} else {
-			a.authCfg.Oauth[key] = serviceConfig
 		}
+		if params.Offline && serviceType == auth.ServiceGithub {
+			// Only GitHub Apps with expiring user tokens issue refresh tokens.
+			a.log.Warn("github oauth apps don't issue refresh tokens, tokens won't be refreshable",
+				zap.String("service", key))
+		}
+		a.authCfg.Oauth[key] = serviceConfig
+	}
+
+	a.authCfg.Policies = a.policies(a.authCfg.Bearer)
+}
+
+// identityConfig is an identity encoding config section.
+type identityConfig struct {
+	Encoding string
+	Secret   string
+}
+
+func (a *app) identityEncoders() (bearer.IdentityEncoder, []bearer.IdentityEncoder) {
+	encoding := a.cfg.GetString(cfgIdentityEncoding)
+	identity, err := bearer.NewIdentityEncoder(encoding, a.cfg.GetString(cfgIdentitySecret))
+	if err != nil {
+		a.log.Fatal("invalid identity encoding", zap.Error(err))
+	}
+
+	var compat []identityConfig
+	if err = a.cfg.UnmarshalKey(cfgIdentityCompat, &compat); err != nil {
+		a.log.Fatal("identity compat encodings are malformed", zap.Error(err))
+	}
+	if encoding != "" && encoding != bearer.IdentitySHA256 && len(compat) == 0 {
+		a.log.Warn("objects uploaded with other identity encodings are not accessible by their owners, " +
+			"list previous encodings in " + cfgIdentityCompat)
+	}
+
+	legacy := make([]bearer.IdentityEncoder, 0, len(compat))
+	for _, c := range compat {
+		encoder, err := bearer.NewIdentityEncoder(c.Encoding, c.Secret)
+		if err != nil {
+			a.log.Fatal("invalid identity compat encoding", zap.Error(err))
+		}
+		legacy = append(legacy, encoder)
 	}
+	return identity, legacy
+}
+
+func (a *app) attributes() []bearer.Attribute {
+	names := a.cfg.GetStringMapString(cfgAttributes)
+	var res []bearer.Attribute
+	// Fixed order keeps eACL filters the same between restarts.
+	for _, value := range []string{bearer.AttributeProvider, bearer.AttributeSubject, bearer.AttributeNameHash} {
+		if name := names[value]; name != "" {
+			res = append(res, bearer.Attribute{Name: name, Value: value})
+		}
+		delete(names, value)
+	}
+	for value := range names {
+		a.log.Fatal("unsupported attribute value", zap.String("value", value))
+	}
+	return res
+}
+
+// policyConfig is a token policy config section. Unset parameters are taken
+// from the neofs section.
+type policyConfig struct {
+	Match struct {
+		Providers []string
+		Emails    []string
+		Domains   []string
+		Groups    []string
+	}
+	CID               string        `mapstructure:"cid"`
+	BearerLifetime    uint64        `mapstructure:"bearer_lifetime"`
+	MaxObjectSize     uint64        `mapstructure:"max_object_size"`
+	MaxObjectLifetime time.Duration `mapstructure:"max_object_lifetime"`
+	UserOperations    []string      `mapstructure:"user_operations"`
+	Containers        []string
+	TokenKinds        []string `mapstructure:"token_kinds"`
+}
+
+func (a *app) policies(base *bearer.Config) []auth.Policy {
+	var configs []policyConfig
+	if err := a.cfg.UnmarshalKey(cfgPolicies, &configs); err != nil {
+		a.log.Fatal("policies are malformed", zap.Error(err))
+	}
+
+	policies := make([]auth.Policy, 0, len(configs))
+	for i, c := range configs {
+		bearerCfg := *base
+		if c.CID != "" {
+			if err := bearerCfg.ContainerID.DecodeString(c.CID); err != nil {
+				a.log.Fatal("policy container id is malformed", zap.Int("policy", i), zap.Error(err))
+			}
+		}
+		if c.BearerLifetime != 0 {
+			bearerCfg.LifeTime = c.BearerLifetime
+		}
+		if c.MaxObjectSize != 0 {
+			bearerCfg.MaxObjectSize = c.MaxObjectSize
+		}
+		if c.MaxObjectLifetime != 0 {
+			bearerCfg.ObjectMaxLifetime = c.MaxObjectLifetime
+		}
+		if c.UserOperations != nil {
+			bearerCfg.UserOperations = c.UserOperations
+		}
+
+		policies = append(policies, auth.Policy{
+			Providers:  c.Match.Providers,
+			Emails:     c.Match.Emails,
+			Domains:    c.Match.Domains,
+			Groups:     c.Match.Groups,
+			Containers: c.Containers,
+			TokenKinds: c.TokenKinds,
+			Bearer:     &bearerCfg,
+		})
+	}
+	return policies
 }
 
 func (a *app) Wait() {
@@ -305,6 +592,12 @@ func (a *app) Serve(ctx context.Context) {
 	myHandler.HandleFunc("/", authenticator.Index)
 	myHandler.HandleFunc("/login", authenticator.LogInWith)
 	myHandler.HandleFunc("/callback", authenticator.Callback)
+	myHandler.HandleFunc("/api/token", authenticator.APIToken)
+	myHandler.HandleFunc("/device", authenticator.Device)
+	myHandler.HandleFunc("/device/code", authenticator.DeviceCode)
+	myHandler.HandleFunc("/device/token", authenticator.DeviceToken)
+	myHandler.HandleFunc("/token", authenticator.Token)
+	myHandler.HandleFunc("/refresh", authenticator.Refresh)
 	a.webServer.Handler = myHandler
 
 	a.gateMetrics.SetServiceStarted()
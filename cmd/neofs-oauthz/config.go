@@ -24,6 +24,19 @@ const (
 	defaultRebalanceTimer    = 15 * time.Second
 	defaultRequestTimeout    = 15 * time.Second
 
+	defaultStateTTL      = 10 * time.Minute
+	defaultStateCapacity = 10000
+
+	defaultDeviceCodeTTL  = 10 * time.Minute
+	defaultDeviceInterval = 5 * time.Second
+	defaultDeviceCapacity = 10000
+
+	defaultLoopbackCodeTTL  = time.Minute
+	defaultLoopbackCapacity = 10000
+
+	defaultRefreshSessionLifetime = 24 * time.Hour
+	defaultRefreshCapacity        = 100000
+
 	defaultListenAddress = "0.0.0.0:8083"
 
 	// Logger.
@@ -33,17 +46,36 @@ const (
 	cfgTLSKey         = "tls_key"
 
 	cfgContainerID             = "neofs.cid"
+	cfgContainers              = "neofs.containers"
 	cfgEmailAttr               = "neofs.bearer_email_attribute"
 	cfgUserID                  = "neofs.bearer_user_id"
+	cfgUserBinding             = "neofs.user_binding"
+	cfgTokenKinds              = "neofs.token_kinds"
+	cfgSessionUnrestricted     = "neofs.session_unrestricted"
+	cfgIdentityEncoding        = "neofs.identity.encoding"
+	cfgIdentitySecret          = "neofs.identity.secret"
+	cfgIdentityCompat          = "neofs.identity.compat"
+	cfgAttributes              = "neofs.attributes"
 	cfgBearerLifetime          = "neofs.bearer_lifetime"
 	cfgBearerMaxObjectSize     = "neofs.max_object_size"
 	cfgBearerMaxObjectLifetime = "neofs.max_object_lifetime"
+	cfgBearerEACL              = "neofs.eacl"
+	cfgBearerUserOperations    = "neofs.user_operations"
+	cfgContentTypesAllow       = "neofs.content_types.allow"
+	cfgContentTypesDeny        = "neofs.content_types.deny"
 	cfgNeoFSWalletPath         = "neofs.wallet.path"
 	cfgNeoFSWalletPassphrase   = "neofs.wallet.passphrase"
 	cfgNeoFSWalletAddress      = "neofs.wallet.address"
 
 	cfgPeers = "peers"
 
+	cfgPolicies = "policies"
+
+	cfgAccessAllow     = "access.allow"
+	cfgAccessDeny      = "access.deny"
+	cfgAccessAllowFile = "access.allow_file"
+	cfgAccessDenyFile  = "access.deny_file"
+
 	cfgConTimeout = "connect_timeout"
 	cfgReqTimeout = "request_timeout"
 	cfgRebalance  = "rebalance_timer"
@@ -54,19 +86,67 @@ const (
 	cmdConfig  = "config"
 
 	cfgBearerCookieName      = "bearer_cookie_name"
+	cfgCookieSecure          = "cookie.secure"
+	cfgCookieHTTPOnly        = "cookie.http_only"
+	cfgCookieSameSite        = "cookie.same_site"
+	cfgCookieDomain          = "cookie.domain"
+	cfgCookiePath            = "cookie.path"
 	cfgOauth                 = "oauth"
+	cfgOauthTypeFmt          = "oauth.%s.type"
+	cfgOauthIssuerFmt        = "oauth.%s.issuer"
+	cfgOauthPKCEFmt          = "oauth.%s.pkce"
 	cfgOauthIDFmt            = "oauth.%s.id"
 	cfgOauthSecretFmt        = "oauth.%s.secret"
 	cfgOauthScopesFmt        = "oauth.%s.scopes"
 	cfgOauthEndpointAuthFmt  = "oauth.%s.endpoint.auth"
 	cfgOauthEndpointTokenFmt = "oauth.%s.endpoint.token"
-	cfgRedirectURL           = "redirect.url"
-	callbackURLFmt           = "%scallback"
+
+	cfgOauthUserInfoURLFmt       = "oauth.%s.userinfo_url"
+	cfgOauthAuthStyleFmt         = "oauth.%s.auth_style"
+	cfgOauthEmailPathFmt         = "oauth.%s.email_path"
+	cfgOauthEmailVerifiedPathFmt = "oauth.%s.email_verified_path"
+	cfgOauthTrustUnverifiedFmt   = "oauth.%s.trust_unverified_email"
+	cfgOauthTrustDomainFmt       = "oauth.%s.trust_unverified_domain"
+	cfgOauthSubjectPathFmt       = "oauth.%s.subject_path"
+	cfgOauthGroupsPathFmt        = "oauth.%s.groups_path"
+	cfgOauthNamePathFmt          = "oauth.%s.name_path"
+
+	cfgOauthBaseURLFmt    = "oauth.%s.base_url"
+	cfgOauthTenantFmt     = "oauth.%s.tenant"
+	cfgOauthTeamIDFmt     = "oauth.%s.team_id"
+	cfgOauthKeyIDFmt      = "oauth.%s.key_id"
+	cfgOauthPrivateKeyFmt = "oauth.%s.private_key"
+
+	cfgRedirectURL     = "redirect.url"
+	cfgRedirectAllowed = "redirect.allowed"
+	cfgStateType       = "state.type"
+	cfgStateTTL        = "state.ttl"
+	cfgStateCapacity   = "state.capacity"
+	cfgStateSecret     = "state.secret"
+	callbackURLFmt     = "%scallback"
+
+	cfgDeviceCodeTTL         = "device.code_ttl"
+	cfgDeviceInterval        = "device.interval"
+	cfgDeviceCapacity        = "device.capacity"
+	cfgDeviceVerificationURI = "device.verification_uri"
+
+	cfgLoopbackCodeTTL  = "loopback.code_ttl"
+	cfgLoopbackCapacity = "loopback.capacity"
+
+	cfgRefreshSecret          = "refresh.secret"
+	cfgRefreshSessionLifetime = "refresh.session_lifetime"
+	cfgRefreshCapacity        = "refresh.capacity"
 
 	cfgPrometheusEnabled = "prometheus.enabled"
 	cfgPrometheusAddress = "prometheus.address"
 )
 
+// Supported state storage types.
+const (
+	stateTypeMemory = "memory"
+	stateTypeSigned = "signed"
+)
+
 var ignore = map[string]struct{}{
 	cmdHelp:    {},
 	cmdVersion: {},